@@ -24,9 +24,29 @@ type LotusGatewayStruct struct {
 		WorkerStats      func(ctx context.Context) (map[uuid.UUID]storiface.WorkerStats, error)
 		SectorsStatus    func(ctx context.Context, sid abi.SectorNumber, showOnChainInfo bool) (api2.SectorInfo, error)
 		MinerProvingInfo func(ctx context.Context, miner address.Address) (*apitypes.ProvingInfo, error)
+		MinerDeadlines   func(ctx context.Context, miner address.Address) (*apitypes.DeadlinesInfo, error)
+		MinerRunway      func(ctx context.Context, miner address.Address) (*apitypes.RunwayInfo, error)
+		WorkerTaskInfo   func(ctx context.Context) ([]*apitypes.WorkerTaskState, error)
+		SectorTimeline   func(ctx context.Context, sid abi.SectorNumber) (*apitypes.SectorTimeline, error)
 	}
 }
 
+func (l *LotusGatewayStruct) WorkerTaskInfo(ctx context.Context) ([]*apitypes.WorkerTaskState, error) {
+	return l.Internal.WorkerTaskInfo(ctx)
+}
+
+func (l *LotusGatewayStruct) SectorTimeline(ctx context.Context, sid abi.SectorNumber) (*apitypes.SectorTimeline, error) {
+	return l.Internal.SectorTimeline(ctx, sid)
+}
+
+func (l *LotusGatewayStruct) MinerDeadlines(ctx context.Context, miner address.Address) (*apitypes.DeadlinesInfo, error) {
+	return l.Internal.MinerDeadlines(ctx, miner)
+}
+
+func (l *LotusGatewayStruct) MinerRunway(ctx context.Context, miner address.Address) (*apitypes.RunwayInfo, error) {
+	return l.Internal.MinerRunway(ctx, miner)
+}
+
 func (l *LotusGatewayStruct) MinerProvingInfo(ctx context.Context, miner address.Address) (*apitypes.ProvingInfo, error) {
 	return l.Internal.MinerProvingInfo(ctx, miner)
 }
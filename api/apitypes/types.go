@@ -1,6 +1,7 @@
 package apitypes
 
 import (
+	"fmt"
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
@@ -28,22 +29,125 @@ type ClusterAssetInfo struct {
 	QualityAdjPower abi.StoragePower `json:"quality_adj_power"`
 	//Owner
 	OwnerBalance big.Int `json:"owner_balance"`
+	// 所有控制地址(owner, worker, control)及余额
+	ControlAddresses []*ControlAddress `json:"control_addresses"`
+	// 存储市场托管余额和其中被锁定的部分
+	MarketEscrow abi.TokenAmount `json:"market_escrow"`
+	MarketLocked abi.TokenAmount `json:"market_locked"`
+	// 已提议但新owner还未确认的owner变更
+	PendingOwner string `json:"pending_owner,omitempty"`
+	// 已提交但还未生效的worker变更, 在 WorkerChangeEpoch 生效
+	PendingWorker     string         `json:"pending_worker,omitempty"`
+	WorkerChangeEpoch abi.ChainEpoch `json:"worker_change_epoch,omitempty"`
 }
 
+type ControlAddress struct {
+	// ID地址
+	Address string `json:"address"`
+	// 公钥地址, 多签等非账户地址为空
+	Key string `json:"key,omitempty"`
+	// owner, worker, control, post(用于提交WindowPoSt的地址)
+	Roles   []string        `json:"roles"`
+	Balance abi.TokenAmount `json:"balance"`
+}
+
+// ProvingInfo 时间字段为Unix秒, 供人阅读的格式见 lotus-monitor proving
 type ProvingInfo struct {
-	CurrentEpoch          abi.ChainEpoch `json:"current_epoch"`
-	ProvingPeriodBoundary abi.ChainEpoch `json:"proving_period_boundary"`
-	ProvingPeriodStart    string         `json:"proving_period_start"`
-	NextPeriodStart       string         `json:"next_period_start"`
-	Faults                string         `json:"faults"`
-	Recovering            uint64         `json:"recovering"`
-	DeadlineIndex         uint64         `json:"deadline_index"`
-	DeadlineSectors       uint64         `json:"deadline_sectors"`
-	DeadlineOpen          string         `json:"deadline_open"`
-	DeadlineClose         string         `json:"deadline_close"`
-	DeadlineElapsed       string         `json:"deadline_elapsed"`
-	DeadlineChallenge     string         `json:"deadline_challenge"`
-	DeadlineFaultCutoff   string         `json:"deadline_fault_cutoff"`
+	CurrentEpoch           abi.ChainEpoch `json:"current_epoch"`
+	ProvingPeriodBoundary  abi.ChainEpoch `json:"proving_period_boundary"`
+	ProvingPeriodStart     abi.ChainEpoch `json:"proving_period_start"`
+	ProvingPeriodStartTime int64          `json:"proving_period_start_time"`
+	NextPeriodStart        abi.ChainEpoch `json:"next_period_start"`
+	NextPeriodStartTime    int64          `json:"next_period_start_time"`
+	// 有效(live)扇区数
+	LiveSectors uint64 `json:"live_sectors"`
+	Faults      uint64 `json:"faults"`
+	// 错误扇区占有效扇区的比例, 0~1
+	FaultRatio        float64        `json:"fault_ratio"`
+	Recovering        uint64         `json:"recovering"`
+	DeadlineIndex     uint64         `json:"deadline_index"`
+	DeadlineSectors   uint64         `json:"deadline_sectors"`
+	DeadlineFaults    uint64         `json:"deadline_faults"`
+	DeadlineOpen      abi.ChainEpoch `json:"deadline_open"`
+	DeadlineOpenTime  int64          `json:"deadline_open_time"`
+	DeadlineClose     abi.ChainEpoch `json:"deadline_close"`
+	DeadlineCloseTime int64          `json:"deadline_close_time"`
+	// deadline的时长(秒)
+	DeadlineDuration        int64          `json:"deadline_duration"`
+	DeadlineChallenge       abi.ChainEpoch `json:"deadline_challenge"`
+	DeadlineChallengeTime   int64          `json:"deadline_challenge_time"`
+	DeadlineFaultCutoff     abi.ChainEpoch `json:"deadline_fault_cutoff"`
+	DeadlineFaultCutoffTime int64          `json:"deadline_fault_cutoff_time"`
+}
+
+// RunwayInfo 按最近的链上花费估算各地址余额还能维持的天数
+type RunwayInfo struct {
+	// 估算花费使用的当前base fee
+	BaseFee abi.TokenAmount `json:"base_fee"`
+	// 实际统计到的时间窗口(秒)
+	Window int64 `json:"window"`
+	// 余额低于该值视为不安全
+	SafeBalance abi.TokenAmount  `json:"safe_balance"`
+	Addresses   []*AddressRunway `json:"addresses"`
+}
+
+type AddressRunway struct {
+	Address string `json:"address"`
+	// owner, worker, control
+	Roles   []string        `json:"roles"`
+	Balance abi.TokenAmount `json:"balance"`
+	// 统计窗口内发送的消息数
+	Messages int `json:"messages"`
+	// 按当前base fee折算的平均每天花费(gas和转出金额)
+	DailySpend abi.TokenAmount `json:"daily_spend"`
+	// 余额降到 SafeBalance 以下前的天数, 没有花费时为空
+	DaysLeft *float64 `json:"days_left,omitempty"`
+}
+
+// EpochEarnings 一个高度上与矿工收益相关的链上数据, 只记录有数据的高度
+type EpochEarnings struct {
+	Height abi.ChainEpoch `json:"height"`
+	// 该高度的时间戳(Unix秒)
+	Timestamp int64 `json:"timestamp"`
+	// 出块数和获胜次数
+	Blocks   int   `json:"blocks"`
+	WinCount int64 `json:"win_count"`
+	// 出块奖励(不含小费)及其中锁定后线性释放的部分
+	Reward       abi.TokenAmount `json:"reward"`
+	RewardLocked abi.TokenAmount `json:"reward_locked"`
+	// 控制地址发送的消息燃烧的gas(base fee燃烧和超额燃烧)
+	GasBurned abi.TokenAmount `json:"gas_burned"`
+	// 转入矿工账户的金额
+	Inflow abi.TokenAmount `json:"inflow"`
+	// 从矿工账户提取的金额
+	Withdrawn abi.TokenAmount `json:"withdrawn"`
+}
+
+// DeadlinesInfo 所有WindowPoSt deadline的扇区和时间
+type DeadlinesInfo struct {
+	MinerID      string          `json:"miner_id"`
+	CurrentEpoch abi.ChainEpoch  `json:"current_epoch"`
+	Deadlines    []*DeadlineInfo `json:"deadlines"`
+}
+
+type DeadlineInfo struct {
+	Index      uint64 `json:"index"`
+	Partitions int    `json:"partitions"`
+	Live       uint64 `json:"live"`
+	Active     uint64 `json:"active"`
+	Faulty     uint64 `json:"faulty"`
+	Recovering uint64 `json:"recovering"`
+	// 当前打开的deadline
+	Current bool `json:"current"`
+	// 本证明周期内还未关闭的deadline为本周期的高度, 否则为下一周期的高度
+	Open      abi.ChainEpoch `json:"open"`
+	Close     abi.ChainEpoch `json:"close"`
+	OpenTime  time.Time      `json:"open_time"`
+	CloseTime time.Time      `json:"close_time"`
+	// 未标记错误, 但sealed或cache文件只在不可访问(StorageStat失败)的路径上或者不存在的扇区
+	Unreachable uint64 `json:"unreachable"`
+	// 存在 Unreachable 扇区, 证明时会产生新的错误扇区
+	AtRisk bool `json:"at_risk"`
 }
 
 type MinerSectorsInfo struct {
@@ -51,14 +155,63 @@ type MinerSectorsInfo struct {
 	Proving      int `json:"proving"`
 }
 
+// PushedMinerInfoSchemaVersion 推送数据的结构版本, 字段有不兼容变更时递增
+const PushedMinerInfoSchemaVersion = 2
+
+// 推送方式
+const (
+	PushModeFull  = "full"  // 完整快照
+	PushModeDelta = "delta" // 只包含相对上一次确认快照的变化
+)
+
 type PushedMinerInfo struct {
-	MinerID          string             `json:"miner_id"`
-	ProvingInfo      *ProvingInfo       `json:"proving_info"`
-	MinerSectorsInfo *MinerSectorsInfo  `json:"miner_sectors_info"`
-	WorkerTaskState  []*WorkerTaskState `json:"worker_task_state"`
+	SchemaVersion int    `json:"schema_version"`
+	MinerID       string `json:"miner_id"`
+	// full 或 delta
+	Mode string `json:"mode"`
+	// 推送序号, 每个矿工单调递增
+	Seq uint64 `json:"seq"`
+	// delta 所基于的快照序号
+	BaseSeq          uint64            `json:"base_seq,omitempty"`
+	ProvingInfo      *ProvingInfo      `json:"proving_info"`
+	MinerSectorsInfo *MinerSectorsInfo `json:"miner_sectors_info"`
+	// full 模式下的完整worker列表
+	WorkerTaskState  []*WorkerTaskState `json:"worker_task_state,omitempty"`
 	ClusterAssetInfo *ClusterAssetInfo  `json:"cluster_asset_info"`
-	StorageInfo      []*StorageInfo     `json:"storage_info"`
-	MessageCount     int                `json:"message_count"`
+	// full 模式下的完整存储路径列表
+	StorageInfo  []*StorageInfo `json:"storage_info,omitempty"`
+	MessageCount int            `json:"message_count"`
+	// 各地址余额可维持的天数, 未开启时为空
+	Runway *RunwayInfo `json:"runway,omitempty"`
+	// delta 模式下worker及任务的变化
+	WorkerTaskDelta *WorkerTaskDelta `json:"worker_task_delta,omitempty"`
+	// delta 模式下存储路径的变化
+	StorageDelta *StorageDelta `json:"storage_delta,omitempty"`
+}
+
+type WorkerTaskDelta struct {
+	Added []*WorkerTaskState `json:"added,omitempty"`
+	// 已移除的workerID
+	Removed []string            `json:"removed,omitempty"`
+	Changed []*WorkerTaskChange `json:"changed,omitempty"`
+}
+
+// worker状态或任务的变化, 任务以 Task+SectorNum 区分
+type WorkerTaskChange struct {
+	ID          string         `json:"id"`
+	Hostname    string         `json:"hostname"`
+	Enable      bool           `json:"enable"`
+	AddedJobs   []*SectorState `json:"added_jobs,omitempty"`
+	RemovedJobs []*SectorState `json:"removed_jobs,omitempty"`
+	ChangedJobs []*SectorState `json:"changed_jobs,omitempty"`
+}
+
+type StorageDelta struct {
+	Added []*StorageInfo `json:"added,omitempty"`
+	// 已移除的存储ID
+	Removed []string `json:"removed,omitempty"`
+	// 发生变化的存储路径, 完整上报
+	Changed []*StorageInfo `json:"changed,omitempty"`
 }
 
 // worker任务状态
@@ -75,20 +228,138 @@ type SectorState struct {
 	SectorNum uint64    `json:"sector_num"`
 	Start     time.Time `json:"start"`
 	RunWait   int       `json:"run_wait"` // 0 - running, 1+ - assigned
-	TaskTime  int64     `json:"task_time,omitempty"`
+	// 已运行时间(秒), 增量推送中只有任务其他字段变化时才会更新
+	TaskTime int64 `json:"task_time,omitempty"`
+	// 该worker此类任务的基准耗时(秒), 历史样本不足时为0
+	Baseline int64 `json:"baseline,omitempty"`
+	// 运行时间超过基准耗时的若干倍
+	Stuck bool `json:"stuck,omitempty"`
+}
+
+// 任务事件的结果
+const (
+	TaskResultStarted = "started"
+	TaskResultOK      = "ok"
+	TaskResultFailed  = "failed"
+)
+
+// 发送给 lotus-task-watcher 的封装任务事件
+type TaskEvent struct {
+	// 由接收方分配
+	ID        uint64 `json:"id,omitempty"`
+	MinerID   string `json:"miner_id"`
+	SectorNum uint64 `json:"sector_num"`
+	// 任务类型, 如 PC1, PC2
+	Task string `json:"task"`
+	// worker的hostname
+	Worker string     `json:"worker"`
+	Start  time.Time  `json:"start"`
+	End    *time.Time `json:"end,omitempty"`
+	// started, ok 或 failed
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	// 由接收方填写
+	ReceivedAt time.Time `json:"received_at,omitempty"`
+}
+
+// 扇区在各封装任务和状态间的时间线
+type SectorTimeline struct {
+	SectorNum uint64               `json:"sector_num"`
+	Tasks     []*SectorTaskSpan    `json:"tasks"`
+	States    []*SectorStateChange `json:"states"`
+}
+
+// 扇区的一次任务, 根据worker任务轮询得到, 时间精度取决于轮询间隔
+type SectorTaskSpan struct {
+	Task     string     `json:"task"`
+	WorkerID string     `json:"worker_id"`
+	Hostname string     `json:"hostname"`
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end,omitempty"`
+	// 耗时(秒), 任务结束后才有
+	Duration int64 `json:"duration,omitempty"`
+}
+
+// 轮询时观察到的扇区状态变化
+type SectorStateChange struct {
+	State string    `json:"state"`
+	At    time.Time `json:"at"`
 }
 
 type StorageInfo struct {
-	ID        string   `json:"id"`
-	Sectors   []*Decl  `json:"sectors"`
-	Capacity  int64    `json:"capacity"`
-	Available int64    `json:"available"` // Available to use for sector storage
-	Reserved  int64    `json:"reserved"`
-	URLs      []string `json:"urls"` // TODO: Support non-http transports
-	Weight    uint64   `json:"weight"`
-	CanSeal   bool     `json:"can_seal"`
-	CanStore  bool     `json:"can_store"`
-	Local     string   `json:"local"`
+	ID      string  `json:"id"`
+	Sectors []*Decl `json:"sectors,omitempty"`
+	// 按文件类型统计的扇区数量, 不上报逐扇区声明时使用
+	SectorSummary map[string]int `json:"sector_summary,omitempty"`
+	Capacity      int64          `json:"capacity"`
+	Available     int64          `json:"available"` // Available to use for sector storage
+	Reserved      int64          `json:"reserved"`
+	URLs          []string       `json:"urls"` // TODO: Support non-http transports
+	Weight        uint64         `json:"weight"`
+	CanSeal       bool           `json:"can_seal"`
+	CanStore      bool           `json:"can_store"`
+	Local         string         `json:"local"`
+	// StorageStat 失败时的错误, 此时 Capacity 等容量信息为0
+	StatError string `json:"stat_error,omitempty"`
+	// 最近一段时间平均每天消耗的空间(字节), 负数表示空间在释放
+	UsageRate int64 `json:"usage_rate,omitempty"`
+	// 按 UsageRate 估算的剩余可用天数, 空间没有在减少或数据不足时为空
+	DaysUntilFull *float64 `json:"days_until_full,omitempty"`
+}
+
+// StorageAudit 存储路径上的扇区声明与矿工扇区列表, 链上有效扇区的一致性检查结果
+type StorageAudit struct {
+	MinerID   string    `json:"miner_id"`
+	CheckedAt time.Time `json:"checked_at"`
+	// 链上有效(live)扇区数, 包括错误扇区
+	LiveSectors int `json:"live_sectors"`
+	// 链上有效但没有sealed文件的扇区
+	MissingSealed []uint64 `json:"missing_sealed"`
+	// 链上有效但没有cache文件的扇区
+	MissingCache []uint64 `json:"missing_cache"`
+	// 同一个扇区文件在多个存储路径上都有声明
+	Duplicates []*SectorFileDecls `json:"duplicates"`
+	// 既不在矿工扇区列表中也不在链上的扇区文件
+	Orphans []*SectorFileDecls `json:"orphans"`
+	// StorageStat 失败的存储路径
+	FailedPaths []*StorageInfo `json:"failed_paths"`
+}
+
+type SectorFileDecls struct {
+	SectorNum  uint64   `json:"sector_num"`
+	FileType   string   `json:"file_type"`
+	StorageIDs []string `json:"storage_ids"`
+}
+
+// Issues 返回发现的问题总数
+func (a *StorageAudit) Issues() int {
+	return len(a.MissingSealed) + len(a.MissingCache) + len(a.Duplicates) + len(a.Orphans) + len(a.FailedPaths)
+}
+
+// 扇区声明的上报方式
+const (
+	DeclModeFull    = "full"    // 上报全部扇区声明
+	DeclModeSummary = "summary" // 只上报按文件类型统计的数量
+	DeclModeNone    = "none"    // 不上报扇区声明
+)
+
+// ApplyDeclMode 按上报方式裁剪扇区声明
+func (si *StorageInfo) ApplyDeclMode(mode string) error {
+	switch mode {
+	case DeclModeFull:
+	case DeclModeSummary:
+		summary := make(map[string]int)
+		for _, decl := range si.Sectors {
+			summary[decl.SectorFileType]++
+		}
+		si.SectorSummary = summary
+		si.Sectors = nil
+	case DeclModeNone:
+		si.Sectors = nil
+	default:
+		return fmt.Errorf("unknown sector decl mode: %s", mode)
+	}
+	return nil
 }
 
 type Decl struct {
@@ -32,4 +32,12 @@ type LotusGatewayAPI interface {
 	SectorsStatus(ctx context.Context, sid abi.SectorNumber, showOnChainInfo bool) (api.SectorInfo, error)
 	// MinerProvingInfo
 	MinerProvingInfo(ctx context.Context, miner address.Address) (*apitypes.ProvingInfo, error)
+	// MinerDeadlines returns sector counts, open/close times and storage risk of every WindowPoSt deadline
+	MinerDeadlines(ctx context.Context, miner address.Address) (*apitypes.DeadlinesInfo, error)
+	// MinerRunway estimates how many days each control address balance lasts at the recent spend rate
+	MinerRunway(ctx context.Context, miner address.Address) (*apitypes.RunwayInfo, error)
+	// WorkerTaskInfo returns workers and their jobs, running jobs are marked stuck when they exceed their baseline duration
+	WorkerTaskInfo(ctx context.Context) ([]*apitypes.WorkerTaskState, error)
+	// SectorTimeline returns the recorded task spans and state changes of the sector
+	SectorTimeline(ctx context.Context, sid abi.SectorNumber) (*apitypes.SectorTimeline, error)
 }
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+)
+
+// 根据 apitypes 生成推送数据的 JSON Schema, 字段说明取自源码注释
+//
+//	go run ./api/schemagen ./api/apitypes > doc/pushed-miner-info.schema.json
+
+type schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Properties  map[string]*schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *schema            `json:"items,omitempty"`
+	Additional  *schema            `json:"additionalProperties,omitempty"`
+	Definitions map[string]*schema `json:"definitions,omitempty"`
+}
+
+type generator struct {
+	// 类型名 -> 注释, 字段 "类型名.字段名" -> 注释
+	docs map[string]string
+	defs map[string]*schema
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func main() {
+	dir := "./api/apitypes"
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+
+	docs, err := parseDocs(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	g := &generator{docs: docs, defs: map[string]*schema{}}
+	root := g.typeSchema(reflect.TypeOf(apitypes.PushedMinerInfo{}))
+	out := &schema{
+		Schema:      "http://json-schema.org/draft-07/schema#",
+		ID:          fmt.Sprintf("https://github.com/guoxiaopeng875/lotus-adapter/pushed-miner-info.v%d.json", apitypes.PushedMinerInfoSchemaVersion),
+		Title:       "PushedMinerInfo",
+		Description: "lotus-monitor push payload, a JSON array of PushedMinerInfo",
+		Type:        "array",
+		Items:       root,
+		Definitions: g.defs,
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func parseDocs(dir string) (map[string]string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath.Clean(dir), err)
+	}
+
+	docs := map[string]string{}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					if doc := commentText(ts.Doc, gd.Doc); doc != "" {
+						docs[ts.Name.Name] = doc
+					}
+					st, ok := ts.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					for _, field := range st.Fields.List {
+						doc := commentText(field.Doc, field.Comment)
+						if doc == "" {
+							continue
+						}
+						for _, name := range field.Names {
+							docs[ts.Name.Name+"."+name.Name] = doc
+						}
+					}
+				}
+			}
+		}
+	}
+	return docs, nil
+}
+
+func commentText(groups ...*ast.CommentGroup) string {
+	for _, cg := range groups {
+		if cg == nil {
+			continue
+		}
+		if text := strings.TrimSpace(cg.Text()); text != "" {
+			return strings.Join(strings.Fields(text), " ")
+		}
+	}
+	return ""
+}
+
+func (g *generator) typeSchema(t reflect.Type) *schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t.Implements(jsonMarshalerType), reflect.PtrTo(t).Implements(jsonMarshalerType),
+		t.Implements(textMarshalerType), reflect.PtrTo(t).Implements(textMarshalerType):
+		// big.Int, address.Address 等都编码为字符串
+		return &schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &schema{Type: "string", Format: "byte"}
+		}
+		return &schema{Type: "array", Items: g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", Additional: g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	case reflect.Interface:
+		return &schema{}
+	default:
+		panic(fmt.Sprintf("unsupported type %s", t))
+	}
+}
+
+func (g *generator) structSchema(t reflect.Type) *schema {
+	name := t.Name()
+	ref := &schema{Ref: "#/definitions/" + name}
+	if _, ok := g.defs[name]; ok {
+		return ref
+	}
+
+	s := &schema{
+		Type:        "object",
+		Description: g.docs[name],
+		Properties:  map[string]*schema{},
+	}
+	// 先占位, 防止递归类型无限展开
+	g.defs[name] = s
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		key := tag[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = f.Name
+		}
+
+		fs := g.typeSchema(f.Type)
+		if doc := g.docs[name+"."+f.Name]; doc != "" {
+			fs.Description = doc
+		}
+		s.Properties[key] = fs
+
+		omitempty := false
+		for _, opt := range tag[1:] {
+			if opt == "omitempty" {
+				omitempty = true
+			}
+		}
+		if !omitempty {
+			s.Required = append(s.Required, key)
+		}
+	}
+
+	return ref
+}
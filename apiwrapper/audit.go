@@ -0,0 +1,208 @@
+package apiwrapper
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api/apibstore"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"golang.org/x/xerrors"
+)
+
+type sectorFile struct {
+	num abi.SectorNumber
+	ft  storiface.SectorFileType
+}
+
+// storageFiles 某个矿工的扇区文件所在的存储路径
+type storageFiles struct {
+	files map[sectorFile][]string
+	// StorageStat 失败的路径
+	failed      map[string]struct{}
+	failedPaths []*apitypes.StorageInfo
+}
+
+// available 扇区文件至少有一个副本在可访问的路径上
+func (sf *storageFiles) available(num abi.SectorNumber, ft storiface.SectorFileType) bool {
+	for _, id := range sf.files[sectorFile{num: num, ft: ft}] {
+		if _, ok := sf.failed[id]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// provable 扇区的sealed和cache文件都可访问
+func (sf *storageFiles) provable(num abi.SectorNumber) bool {
+	return sf.available(num, storiface.FTSealed) && sf.available(num, storiface.FTCache)
+}
+
+func (c *LotusAPIWrapper) loadStorageFiles(ctx context.Context, mid abi.ActorID) (*storageFiles, error) {
+	list, err := c.StorageMiner.StorageList(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("listing storage: %w", err)
+	}
+	local, err := c.StorageMiner.StorageLocal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	failedPaths := []*apitypes.StorageInfo{}
+	for id := range list {
+		if _, err := c.StorageMiner.StorageStat(ctx, id); err != nil {
+			si := &apitypes.StorageInfo{ID: string(id), Local: local[id], StatError: err.Error()}
+			if info, err := c.StorageMiner.StorageInfo(ctx, id); err == nil {
+				si.URLs = info.URLs
+				si.CanSeal = info.CanSeal
+				si.CanStore = info.CanStore
+			}
+			failedPaths = append(failedPaths, si)
+		}
+	}
+	return newStorageFiles(list, mid, failedPaths), nil
+}
+
+// newStorageFiles 按存储路径上的声明整理矿工的扇区文件, failedPaths 为 StorageStat 失败的路径
+func newStorageFiles(list map[stores.ID][]stores.Decl, mid abi.ActorID, failedPaths []*apitypes.StorageInfo) *storageFiles {
+	sf := &storageFiles{
+		files:       map[sectorFile][]string{},
+		failed:      map[string]struct{}{},
+		failedPaths: failedPaths,
+	}
+	for _, si := range failedPaths {
+		sf.failed[si.ID] = struct{}{}
+	}
+	for id, decls := range list {
+		for _, decl := range decls {
+			if decl.Miner != mid {
+				continue
+			}
+			for _, ft := range storiface.PathTypes {
+				if decl.SectorFileType&ft != 0 {
+					k := sectorFile{num: decl.Number, ft: ft}
+					sf.files[k] = append(sf.files[k], string(id))
+				}
+			}
+		}
+	}
+	return sf
+}
+
+// StorageAudit 对比存储路径上的扇区声明和矿工扇区列表, 链上有效扇区, 找出缺少sealed/cache文件的有效扇区,
+// 重复的扇区文件, 孤立的扇区文件和 StorageStat 失败的路径. 失败路径上的文件不算作有效副本
+func (c *LotusAPIWrapper) StorageAudit(ctx context.Context, mAddr address.Address) (*apitypes.StorageAudit, error) {
+	mid, err := address.IDFromAddress(mAddr)
+	if err != nil {
+		return nil, err
+	}
+	live, err := c.liveSectors(ctx, mAddr)
+	if err != nil {
+		return nil, err
+	}
+	sectors, err := c.StorageMiner.SectorsList(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("listing sectors: %w", err)
+	}
+	known := make(map[abi.SectorNumber]struct{}, len(sectors))
+	for _, num := range sectors {
+		known[num] = struct{}{}
+	}
+	sf, err := c.loadStorageFiles(ctx, abi.ActorID(mid))
+	if err != nil {
+		return nil, err
+	}
+	return auditStorage(mAddr, live, known, sf, time.Now()), nil
+}
+
+// auditStorage 根据链上有效扇区, 矿工扇区列表和扇区文件生成检查结果
+func auditStorage(mAddr address.Address, live, known map[abi.SectorNumber]struct{}, sf *storageFiles, now time.Time) *apitypes.StorageAudit {
+	audit := &apitypes.StorageAudit{
+		MinerID:       mAddr.String(),
+		CheckedAt:     now,
+		LiveSectors:   len(live),
+		MissingSealed: []uint64{},
+		MissingCache:  []uint64{},
+		Duplicates:    []*apitypes.SectorFileDecls{},
+		Orphans:       []*apitypes.SectorFileDecls{},
+		FailedPaths:   sf.failedPaths,
+	}
+
+	for num := range live {
+		if !sf.available(num, storiface.FTSealed) {
+			audit.MissingSealed = append(audit.MissingSealed, uint64(num))
+		}
+		if !sf.available(num, storiface.FTCache) {
+			audit.MissingCache = append(audit.MissingCache, uint64(num))
+		}
+	}
+
+	for k, ids := range sf.files {
+		sort.Strings(ids)
+		decls := &apitypes.SectorFileDecls{SectorNum: uint64(k.num), FileType: k.ft.String(), StorageIDs: ids}
+		if len(ids) > 1 {
+			audit.Duplicates = append(audit.Duplicates, decls)
+		}
+		_, isLive := live[k.num]
+		_, isKnown := known[k.num]
+		if !isLive && !isKnown {
+			audit.Orphans = append(audit.Orphans, decls)
+		}
+	}
+
+	sortNums := func(s []uint64) {
+		sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	}
+	sortDecls := func(s []*apitypes.SectorFileDecls) {
+		sort.Slice(s, func(i, j int) bool {
+			if s[i].SectorNum != s[j].SectorNum {
+				return s[i].SectorNum < s[j].SectorNum
+			}
+			return s[i].FileType < s[j].FileType
+		})
+	}
+	sortNums(audit.MissingSealed)
+	sortNums(audit.MissingCache)
+	sortDecls(audit.Duplicates)
+	sortDecls(audit.Orphans)
+	sort.Slice(audit.FailedPaths, func(i, j int) bool {
+		return audit.FailedPaths[i].ID < audit.FailedPaths[j].ID
+	})
+	return audit
+}
+
+// liveSectors 返回链上所有分区的有效扇区, 包括错误扇区
+func (c *LotusAPIWrapper) liveSectors(ctx context.Context, mAddr address.Address) (map[abi.SectorNumber]struct{}, error) {
+	mact, err := c.FullNode.StateGetActor(ctx, mAddr, types.EmptyTSK)
+	if err != nil {
+		return nil, err
+	}
+	mas, err := miner.Load(store.ActorStore(ctx, apibstore.NewAPIBlockstore(c.FullNode)), mact)
+	if err != nil {
+		return nil, err
+	}
+
+	live := map[abi.SectorNumber]struct{}{}
+	if err := mas.ForEachDeadline(func(dlIdx uint64, dl miner.Deadline) error {
+		return dl.ForEachPartition(func(partIdx uint64, part miner.Partition) error {
+			bf, err := part.LiveSectors()
+			if err != nil {
+				return err
+			}
+			return bf.ForEach(func(num uint64) error {
+				live[abi.SectorNumber(num)] = struct{}{}
+				return nil
+			})
+		})
+	}); err != nil {
+		return nil, xerrors.Errorf("walking miner deadlines and partitions: %w", err)
+	}
+	return live, nil
+}
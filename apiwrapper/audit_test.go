@@ -0,0 +1,99 @@
+package apiwrapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditStorage(t *testing.T) {
+	mAddr, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	decl := func(num abi.SectorNumber, ft storiface.SectorFileType) stores.Decl {
+		return stores.Decl{SectorID: abi.SectorID{Miner: 1000, Number: num}, SectorFileType: ft}
+	}
+	sectors := func(nums ...abi.SectorNumber) map[abi.SectorNumber]struct{} {
+		set := map[abi.SectorNumber]struct{}{}
+		for _, n := range nums {
+			set[n] = struct{}{}
+		}
+		return set
+	}
+	both := storiface.FTSealed | storiface.FTCache
+
+	for _, tc := range []struct {
+		name   string
+		list   map[stores.ID][]stores.Decl
+		failed []string
+		live   map[abi.SectorNumber]struct{}
+		known  map[abi.SectorNumber]struct{}
+
+		missingSealed []uint64
+		missingCache  []uint64
+		duplicates    []*apitypes.SectorFileDecls
+		orphans       []*apitypes.SectorFileDecls
+	}{
+		{
+			name: "declared but missing",
+			list: map[stores.ID][]stores.Decl{
+				"a": {decl(1, both), decl(2, storiface.FTSealed)},
+				// 失败路径上的文件不算有效副本
+				"b": {decl(3, both)},
+			},
+			failed:        []string{"b"},
+			live:          sectors(1, 2, 3, 4),
+			known:         sectors(1, 2, 3, 4),
+			missingSealed: []uint64{3, 4},
+			missingCache:  []uint64{2, 3, 4},
+		},
+		{
+			name: "undeclared files",
+			list: map[stores.ID][]stores.Decl{
+				"a": {decl(1, both), decl(5, storiface.FTSealed)},
+				"b": {decl(1, storiface.FTSealed), decl(6, storiface.FTUnsealed),
+					// 其他矿工的文件不检查
+					{SectorID: abi.SectorID{Miner: 2000, Number: 7}, SectorFileType: storiface.FTSealed}},
+			},
+			live:  sectors(1),
+			known: sectors(1),
+			duplicates: []*apitypes.SectorFileDecls{
+				{SectorNum: 1, FileType: "sealed", StorageIDs: []string{"a", "b"}},
+			},
+			orphans: []*apitypes.SectorFileDecls{
+				{SectorNum: 5, FileType: "sealed", StorageIDs: []string{"a"}},
+				{SectorNum: 6, FileType: "unsealed", StorageIDs: []string{"b"}},
+			},
+		},
+		{
+			name: "non-live sectors",
+			list: map[stores.ID][]stores.Decl{
+				// 还在封装或已终止的扇区, 矿工扇区列表中有, 不是孤立文件, 也不要求有sealed
+				"a": {decl(8, storiface.FTUnsealed), decl(9, storiface.FTCache)},
+			},
+			live:  sectors(),
+			known: sectors(8, 9, 10),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var failed []*apitypes.StorageInfo
+			for _, id := range tc.failed {
+				failed = append(failed, &apitypes.StorageInfo{ID: id, StatError: "stat failed"})
+			}
+			sf := newStorageFiles(tc.list, 1000, failed)
+			audit := auditStorage(mAddr, tc.live, tc.known, sf, time.Now())
+
+			require.Equal(t, len(tc.live), audit.LiveSectors)
+			require.Equal(t, append([]uint64{}, tc.missingSealed...), audit.MissingSealed)
+			require.Equal(t, append([]uint64{}, tc.missingCache...), audit.MissingCache)
+			require.Equal(t, append([]*apitypes.SectorFileDecls{}, tc.duplicates...), audit.Duplicates)
+			require.Equal(t, append([]*apitypes.SectorFileDecls{}, tc.orphans...), audit.Orphans)
+			require.Len(t, audit.FailedPaths, len(tc.failed))
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package apiwrapper
+
+import (
+	"context"
+	"sort"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/actors/adt"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	builtin2 "github.com/filecoin-project/specs-actors/v2/actors/builtin"
+	miner2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/miner"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// controlAddresses 返回矿工所有控制地址的角色和余额, post 为用于提交WindowPoSt的地址
+func (c *LotusAPIWrapper) controlAddresses(ctx context.Context, mi miner.MinerInfo, post address.Address) ([]*apitypes.ControlAddress, error) {
+	roles := controlRoles(mi.Owner, mi.Worker, mi.ControlAddresses)
+	roles[post] = append(roles[post], "post")
+
+	out := make([]*apitypes.ControlAddress, 0, len(roles))
+	for id, r := range roles {
+		bal, err := c.FullNode.WalletBalance(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		ca := &apitypes.ControlAddress{Address: id.String(), Roles: r, Balance: bal}
+		// owner可能是多签, 没有公钥地址
+		if key, err := c.FullNode.StateAccountKey(ctx, id, types.EmptyTSK); err == nil {
+			ca.Key = key.String()
+		}
+		out = append(out, ca)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Address < out[j].Address
+	})
+	return out, nil
+}
+
+// pendingOwner 返回已提议但还未确认的新owner. lotus的 MinerInfo 不包含该字段, v2之前的actor也不支持变更owner
+func pendingOwner(ctx context.Context, bs cbor.IpldBlockstore, mact *types.Actor) (string, error) {
+	if mact.Code != builtin2.StorageMinerActorCodeID {
+		return "", nil
+	}
+	store := adt.WrapStore(ctx, cbor.NewCborStore(bs))
+	var st miner2.State
+	if err := store.Get(ctx, mact.Head, &st); err != nil {
+		return "", xerrors.Errorf("loading miner state: %w", err)
+	}
+	info, err := st.GetInfo(store)
+	if err != nil {
+		return "", xerrors.Errorf("loading miner info: %w", err)
+	}
+	if info.PendingOwnerAddress == nil {
+		return "", nil
+	}
+	return info.PendingOwnerAddress.String(), nil
+}
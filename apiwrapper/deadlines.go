@@ -0,0 +1,112 @@
+package apiwrapper
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api/apibstore"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"golang.org/x/xerrors"
+)
+
+// MinerDeadlines 返回全部deadline的扇区数量, 打开/关闭时间, 以及扇区文件不可访问的风险
+func (c *LotusAPIWrapper) MinerDeadlines(ctx context.Context, mAddr address.Address) (*apitypes.DeadlinesInfo, error) {
+	node := c.FullNode
+	mid, err := address.IDFromAddress(mAddr)
+	if err != nil {
+		return nil, err
+	}
+	head, err := node.ChainHead(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("getting chain head: %w", err)
+	}
+	mact, err := node.StateGetActor(ctx, mAddr, head.Key())
+	if err != nil {
+		return nil, err
+	}
+	mas, err := miner.Load(store.ActorStore(ctx, apibstore.NewAPIBlockstore(node)), mact)
+	if err != nil {
+		return nil, err
+	}
+	cd, err := node.StateMinerProvingDeadline(ctx, mAddr, head.Key())
+	if err != nil {
+		return nil, xerrors.Errorf("getting proving deadline: %w", err)
+	}
+	sf, err := c.loadStorageFiles(ctx, abi.ActorID(mid))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &apitypes.DeadlinesInfo{
+		MinerID:      mAddr.String(),
+		CurrentEpoch: cd.CurrentEpoch,
+		Deadlines:    make([]*apitypes.DeadlineInfo, 0, cd.WPoStPeriodDeadlines),
+	}
+	if err := mas.ForEachDeadline(func(dlIdx uint64, dl miner.Deadline) error {
+		open := cd.PeriodStart + abi.ChainEpoch(dlIdx)*cd.WPoStChallengeWindow
+		if dlIdx < cd.Index {
+			open += cd.WPoStProvingPeriod
+		}
+		di := &apitypes.DeadlineInfo{
+			Index:     dlIdx,
+			Current:   dlIdx == cd.Index,
+			Open:      open,
+			Close:     open + cd.WPoStChallengeWindow,
+			OpenTime:  epochTime(head, open),
+			CloseTime: epochTime(head, open+cd.WPoStChallengeWindow),
+		}
+		if err := dl.ForEachPartition(func(partIdx uint64, part miner.Partition) error {
+			di.Partitions++
+			for _, f := range []struct {
+				get   func() (bitfield.BitField, error)
+				count *uint64
+			}{
+				{part.LiveSectors, &di.Live},
+				{part.ActiveSectors, &di.Active},
+				{part.FaultySectors, &di.Faulty},
+				{part.RecoveringSectors, &di.Recovering},
+			} {
+				bf, err := f.get()
+				if err != nil {
+					return err
+				}
+				n, err := bf.Count()
+				if err != nil {
+					return err
+				}
+				*f.count += n
+			}
+
+			live, err := part.LiveSectors()
+			if err != nil {
+				return err
+			}
+			faulty, err := part.FaultySectors()
+			if err != nil {
+				return err
+			}
+			healthy, err := bitfield.SubtractBitField(live, faulty)
+			if err != nil {
+				return err
+			}
+			return healthy.ForEach(func(num uint64) error {
+				if !sf.provable(abi.SectorNumber(num)) {
+					di.Unreachable++
+				}
+				return nil
+			})
+		}); err != nil {
+			return err
+		}
+		di.AtRisk = di.Unreachable > 0
+		out.Deadlines = append(out.Deadlines, di)
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("walking miner deadlines and partitions: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,199 @@
+package apiwrapper
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apibstore"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/reward"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/vm"
+	builtin2 "github.com/filecoin-project/specs-actors/v2/actors/builtin"
+	miner2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/miner"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// MaxEarningsScan MinerEarnings 一次最多往回遍历的时长, 监控中断更久时中间的数据会缺失
+const MaxEarningsScan = 24 * time.Hour
+
+// MinerEarnings 遍历 (from, head] 内的tipset, 返回每个高度上矿工的出块奖励, 控制地址燃烧的gas,
+// 转入和提取的金额, 以及下次调用应使用的 from. 最多往回遍历 MaxEarningsScan.
+// 同一个高度可能在两次调用中都返回, 内容相同
+func (c *LotusAPIWrapper) MinerEarnings(ctx context.Context, mAddr address.Address, from abi.ChainEpoch) ([]*apitypes.EpochEarnings, abi.ChainEpoch, error) {
+	node := c.FullNode
+	head, err := node.ChainHead(ctx)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("getting chain head: %w", err)
+	}
+	if oldest := head.Height() - abi.ChainEpoch(MaxEarningsScan/(time.Duration(build.BlockDelaySecs)*time.Second)); from < oldest {
+		from = oldest
+	}
+	mi, err := node.StateMinerInfo(ctx, mAddr, head.Key())
+	if err != nil {
+		return nil, 0, err
+	}
+	watched := watchedAddresses(ctx, node, controlRoles(mi.Owner, mi.Worker, mi.ControlAddresses), head.Key())
+
+	recs := make(map[abi.ChainEpoch]*apitypes.EpochEarnings)
+	at := func(ts *types.TipSet) *apitypes.EpochEarnings {
+		e, ok := recs[ts.Height()]
+		if !ok {
+			e = &apitypes.EpochEarnings{
+				Height:       ts.Height(),
+				Timestamp:    int64(ts.MinTimestamp()),
+				Reward:       big.Zero(),
+				RewardLocked: big.Zero(),
+				GasBurned:    big.Zero(),
+				Inflow:       big.Zero(),
+				Withdrawn:    big.Zero(),
+			}
+			recs[ts.Height()] = e
+		}
+		return e
+	}
+
+	// head中的消息还没有执行, 下次从head的父tipset开始
+	next := from
+	cur := head
+	for cur.Height() > from && cur.Height() > 0 {
+		parent, err := node.ChainGetTipSet(ctx, cur.Parents())
+		if err != nil {
+			return nil, 0, xerrors.Errorf("loading tipset %s: %w", cur.Parents(), err)
+		}
+		if cur == head {
+			next = parent.Height()
+		}
+		if err := loadBlockRewards(ctx, node, mAddr, cur, parent, at); err != nil {
+			return nil, 0, err
+		}
+		if parent.Height() > from {
+			if err := loadMinerMessages(ctx, node, mAddr, cur, parent, watched, at); err != nil {
+				return nil, 0, err
+			}
+		}
+		cur = parent
+	}
+
+	out := make([]*apitypes.EpochEarnings, 0, len(recs))
+	for _, e := range recs {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Height < out[j].Height
+	})
+	return out, next, nil
+}
+
+// loadBlockRewards 统计 ts 中矿工出的块, 奖励按父tipset执行后的奖励actor状态计算
+func loadBlockRewards(ctx context.Context, node api.FullNode, mAddr address.Address, ts, parent *types.TipSet, at func(*types.TipSet) *apitypes.EpochEarnings) error {
+	var blocks int
+	var wins int64
+	for _, b := range ts.Blocks() {
+		if b.Miner == mAddr && b.ElectionProof != nil {
+			blocks++
+			wins += b.ElectionProof.WinCount
+		}
+	}
+	if blocks == 0 {
+		return nil
+	}
+
+	ract, err := node.StateGetActor(ctx, reward.Address, parent.Key())
+	if err != nil {
+		return xerrors.Errorf("getting reward actor at %d: %w", parent.Height(), err)
+	}
+	rst, err := reward.Load(store.ActorStore(ctx, apibstore.NewAPIBlockstore(node)), ract)
+	if err != nil {
+		return xerrors.Errorf("loading reward actor state: %w", err)
+	}
+	epochReward, err := rst.ThisEpochReward()
+	if err != nil {
+		return err
+	}
+	nv, err := node.StateNetworkVersion(ctx, parent.Key())
+	if err != nil {
+		return err
+	}
+	r := big.Div(big.Mul(epochReward, big.NewInt(wins)), big.NewInt(int64(build.BlocksPerEpoch)))
+	locked, _ := miner2.LockedRewardFromReward(r, nv)
+
+	e := at(ts)
+	e.Blocks += blocks
+	e.WinCount += wins
+	e.Reward = big.Add(e.Reward, r)
+	e.RewardLocked = big.Add(e.RewardLocked, locked)
+	return nil
+}
+
+// loadMinerMessages 统计 parent 中控制地址发送的消息燃烧的gas, 以及执行成功的转入矿工和提取余额的金额
+func loadMinerMessages(ctx context.Context, node api.FullNode, mAddr address.Address, ts, parent *types.TipSet, watched map[address.Address]address.Address, at func(*types.TipSet) *apitypes.EpochEarnings) error {
+	msgs, err := node.ChainGetParentMessages(ctx, ts.Cids()[0])
+	if err != nil {
+		return xerrors.Errorf("getting parent messages at %d: %w", ts.Height(), err)
+	}
+	var rcpts []*types.MessageReceipt
+	baseFee := parent.Blocks()[0].ParentBaseFee
+	for i, m := range msgs {
+		_, fromControl := watched[m.Message.From]
+		toMiner := m.Message.To == mAddr
+		if !fromControl && !toMiner {
+			continue
+		}
+		if rcpts == nil {
+			if rcpts, err = node.ChainGetParentReceipts(ctx, ts.Cids()[0]); err != nil {
+				return xerrors.Errorf("getting parent receipts at %d: %w", ts.Height(), err)
+			}
+		}
+		if i >= len(rcpts) {
+			return xerrors.Errorf("missing receipt for message %s", m.Cid)
+		}
+		r := rcpts[i]
+
+		if fromControl {
+			out := vm.ComputeGasOutputs(r.GasUsed, m.Message.GasLimit, baseFee, m.Message.GasFeeCap, m.Message.GasPremium)
+			e := at(parent)
+			e.GasBurned = big.Add(e.GasBurned, big.Add(out.BaseFeeBurn, out.OverEstimationBurn))
+		}
+		if !toMiner || !r.ExitCode.IsSuccess() {
+			continue
+		}
+		if !m.Message.Value.IsZero() {
+			e := at(parent)
+			e.Inflow = big.Add(e.Inflow, m.Message.Value)
+		}
+		if m.Message.Method == builtin2.MethodsMiner.WithdrawBalance {
+			w, err := withdrawn(ctx, node, mAddr, parent, m.Cid)
+			if err != nil {
+				return err
+			}
+			e := at(parent)
+			e.Withdrawn = big.Add(e.Withdrawn, w)
+		}
+	}
+	return nil
+}
+
+// withdrawn 重放提取余额的消息, 返回实际转出的金额. 偿还欠款转给销毁地址的部分不算提取
+func withdrawn(ctx context.Context, node api.FullNode, mAddr address.Address, ts *types.TipSet, mc cid.Cid) (abi.TokenAmount, error) {
+	res, err := node.StateReplay(ctx, ts.Key(), mc)
+	if err != nil {
+		return big.Zero(), xerrors.Errorf("replaying withdraw message %s: %w", mc, err)
+	}
+	total := big.Zero()
+	for _, sub := range res.ExecutionTrace.Subcalls {
+		if sub.Msg.From != mAddr || sub.Msg.To == builtin2.BurntFundsActorAddr || !sub.MsgRct.ExitCode.IsSuccess() {
+			continue
+		}
+		total = big.Add(total, sub.Msg.Value)
+	}
+	return total, nil
+}
@@ -0,0 +1,268 @@
+package apiwrapper
+
+import (
+	"context"
+	"math"
+	stdbig "math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/vm"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"golang.org/x/xerrors"
+)
+
+type RunwayOptions struct {
+	// 统计链上花费的时间窗口
+	Window time.Duration
+	// 余额低于该值视为不安全
+	SafeBalance abi.TokenAmount
+}
+
+func DefaultRunwayOptions() RunwayOptions {
+	return RunwayOptions{
+		Window:      24 * time.Hour,
+		SafeBalance: types.FromFil(1),
+	}
+}
+
+// addrSpend 一个地址在一个高度上的花费
+type addrSpend struct {
+	msgs    int
+	gasUsed int64
+	// 小费, 超额gas燃烧和转出金额, 与base fee无关的部分
+	other abi.TokenAmount
+}
+
+type epochSpend struct {
+	height abi.ChainEpoch
+	spend  map[address.Address]*addrSpend
+}
+
+// spendTracker 逐个tipset累计矿工控制地址发送的消息的花费, 只保留最近 window 个高度
+type spendTracker struct {
+	lk     sync.Mutex
+	window abi.ChainEpoch
+	// 已经统计过的最高高度
+	last   abi.ChainEpoch
+	epochs []*epochSpend
+}
+
+// SetRunwayOptions 设置 MinerRunway 的统计窗口和安全余额
+func (c *LotusAPIWrapper) SetRunwayOptions(opts RunwayOptions) {
+	c.runwayOpts = opts
+}
+
+// MinerRunway 统计最近一段时间owner, worker和control地址的链上花费(gas和转出金额), 按当前base fee折算为每天的花费,
+// 估算各地址余额降到安全余额以下前的天数. 第一次调用需要遍历整个统计窗口的消息, 之后只处理新的tipset
+func (c *LotusAPIWrapper) MinerRunway(ctx context.Context, mAddr address.Address) (*apitypes.RunwayInfo, error) {
+	node := c.FullNode
+	head, err := node.ChainHead(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("getting chain head: %w", err)
+	}
+	mi, err := node.StateMinerInfo(ctx, mAddr, head.Key())
+	if err != nil {
+		return nil, err
+	}
+
+	roles := controlRoles(mi.Owner, mi.Worker, mi.ControlAddresses)
+	watched := watchedAddresses(ctx, node, roles, head.Key())
+
+	st := c.spendTracker(mAddr)
+	st.lk.Lock()
+	defer st.lk.Unlock()
+	if err := st.update(ctx, node, head, watched); err != nil {
+		return nil, err
+	}
+
+	baseFee := head.Blocks()[0].ParentBaseFee
+	covered := st.covered(head.Height())
+	ri := &apitypes.RunwayInfo{
+		BaseFee:     baseFee,
+		Window:      int64(covered) * int64(build.BlockDelaySecs),
+		SafeBalance: c.runwayOpts.SafeBalance,
+	}
+	total := st.total()
+	epochsPerDay := int64(24*time.Hour/time.Second) / int64(build.BlockDelaySecs)
+	for id, r := range roles {
+		bal, err := node.WalletBalance(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		ar := &apitypes.AddressRunway{
+			Address:    id.String(),
+			Roles:      r,
+			Balance:    bal,
+			DailySpend: big.Zero(),
+		}
+		if s, ok := total[id]; ok && covered > 0 {
+			spent := big.Add(big.Mul(big.NewInt(s.gasUsed), baseFee), s.other)
+			ar.Messages = s.msgs
+			ar.DailySpend = big.Div(big.Mul(spent, big.NewInt(epochsPerDay)), big.NewInt(int64(covered)))
+		}
+		if ar.DailySpend.GreaterThan(big.Zero()) {
+			days := 0.0
+			if left := big.Sub(bal, ri.SafeBalance); left.GreaterThan(big.Zero()) {
+				days = math.Round(toFloat(left)/toFloat(ar.DailySpend)*10) / 10
+			}
+			ar.DaysLeft = &days
+		}
+		ri.Addresses = append(ri.Addresses, ar)
+	}
+	sort.Slice(ri.Addresses, func(i, j int) bool {
+		return ri.Addresses[i].Address < ri.Addresses[j].Address
+	})
+	return ri, nil
+}
+
+func (c *LotusAPIWrapper) spendTracker(mAddr address.Address) *spendTracker {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	st, ok := c.spends[mAddr]
+	if !ok {
+		st = &spendTracker{window: abi.ChainEpoch(c.runwayOpts.Window / (time.Duration(build.BlockDelaySecs) * time.Second))}
+		c.spends[mAddr] = st
+	}
+	return st
+}
+
+// controlRoles 返回每个控制地址的角色
+func controlRoles(owner, worker address.Address, controls []address.Address) map[address.Address][]string {
+	roles := map[address.Address][]string{}
+	roles[owner] = append(roles[owner], "owner")
+	roles[worker] = append(roles[worker], "worker")
+	for _, ca := range controls {
+		roles[ca] = append(roles[ca], "control")
+	}
+	return roles
+}
+
+// watchedAddresses 返回控制地址的ID地址和公钥地址到ID地址的映射, 消息的发送方可能是ID地址也可能是公钥地址
+func watchedAddresses(ctx context.Context, node api.FullNode, roles map[address.Address][]string, tsk types.TipSetKey) map[address.Address]address.Address {
+	watched := make(map[address.Address]address.Address, 2*len(roles))
+	for id := range roles {
+		watched[id] = id
+		if key, err := node.StateAccountKey(ctx, id, tsk); err == nil {
+			watched[key] = id
+		}
+	}
+	return watched
+}
+
+// update 从 head 往回处理还没统计过的tipset, 每个tipset的父消息用父tipset的base fee计算花费
+func (st *spendTracker) update(ctx context.Context, node api.FullNode, head *types.TipSet, watched map[address.Address]address.Address) error {
+	stop := head.Height() - st.window
+	if st.last > stop {
+		stop = st.last
+	}
+
+	var added []*epochSpend
+	cur := head
+	for cur.Height() > 0 {
+		parent, err := node.ChainGetTipSet(ctx, cur.Parents())
+		if err != nil {
+			return xerrors.Errorf("loading tipset %s: %w", cur.Parents(), err)
+		}
+		if parent.Height() <= stop {
+			break
+		}
+		es, err := loadEpochSpend(ctx, node, cur, parent, watched)
+		if err != nil {
+			return err
+		}
+		added = append(added, es)
+		cur = parent
+	}
+
+	for i := len(added) - 1; i >= 0; i-- {
+		st.epochs = append(st.epochs, added[i])
+	}
+	if len(added) > 0 {
+		st.last = added[0].height
+	}
+	cutoff := head.Height() - st.window
+	for len(st.epochs) > 0 && st.epochs[0].height <= cutoff {
+		st.epochs = st.epochs[1:]
+	}
+	return nil
+}
+
+func loadEpochSpend(ctx context.Context, node api.FullNode, ts, parent *types.TipSet, watched map[address.Address]address.Address) (*epochSpend, error) {
+	es := &epochSpend{height: parent.Height(), spend: map[address.Address]*addrSpend{}}
+	msgs, err := node.ChainGetParentMessages(ctx, ts.Cids()[0])
+	if err != nil {
+		return nil, xerrors.Errorf("getting parent messages at %d: %w", ts.Height(), err)
+	}
+	var rcpts []*types.MessageReceipt
+	baseFee := parent.Blocks()[0].ParentBaseFee
+	for i, m := range msgs {
+		id, ok := watched[m.Message.From]
+		if !ok {
+			continue
+		}
+		// 只有涉及控制地址时才取回执
+		if rcpts == nil {
+			if rcpts, err = node.ChainGetParentReceipts(ctx, ts.Cids()[0]); err != nil {
+				return nil, xerrors.Errorf("getting parent receipts at %d: %w", ts.Height(), err)
+			}
+		}
+		if i >= len(rcpts) {
+			return nil, xerrors.Errorf("missing receipt for message %s", m.Cid)
+		}
+		r := rcpts[i]
+		out := vm.ComputeGasOutputs(r.GasUsed, m.Message.GasLimit, baseFee, m.Message.GasFeeCap, m.Message.GasPremium)
+		other := big.Add(out.MinerTip, out.OverEstimationBurn)
+		if r.ExitCode.IsSuccess() {
+			other = big.Add(other, m.Message.Value)
+		}
+
+		s, ok := es.spend[id]
+		if !ok {
+			s = &addrSpend{other: big.Zero()}
+			es.spend[id] = s
+		}
+		s.msgs++
+		s.gasUsed += r.GasUsed
+		s.other = big.Add(s.other, other)
+	}
+	return es, nil
+}
+
+// covered 已统计的高度数
+func (st *spendTracker) covered(head abi.ChainEpoch) abi.ChainEpoch {
+	if len(st.epochs) == 0 {
+		return 0
+	}
+	return head - st.epochs[0].height + 1
+}
+
+func (st *spendTracker) total() map[address.Address]*addrSpend {
+	total := map[address.Address]*addrSpend{}
+	for _, es := range st.epochs {
+		for id, s := range es.spend {
+			t, ok := total[id]
+			if !ok {
+				t = &addrSpend{other: big.Zero()}
+				total[id] = t
+			}
+			t.msgs += s.msgs
+			t.gasUsed += s.gasUsed
+			t.other = big.Add(t.other, s.other)
+		}
+	}
+	return total
+}
+
+func toFloat(v abi.TokenAmount) float64 {
+	f, _ := new(stdbig.Float).SetInt(v.Int).Float64()
+	return f
+}
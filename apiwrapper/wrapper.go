@@ -2,8 +2,8 @@ package apiwrapper
 
 import (
 	"context"
-	"fmt"
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/apibstore"
 	"github.com/filecoin-project/lotus/build"
@@ -11,34 +11,52 @@ import (
 	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
-	"github.com/filecoin-project/lotus/cli"
 	"github.com/filecoin-project/lotus/extern/sector-storage/fsutil"
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
 	"github.com/filecoin-project/lotus/lib/blockstore"
 	"github.com/filecoin-project/lotus/lib/bufbstore"
 	"github.com/filecoin-project/lotus/storage"
 	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
-	"github.com/hako/durafmt"
+	"github.com/guoxiaopeng875/lotus-adapter/tracker"
 	cbor "github.com/ipfs/go-ipld-cbor"
+	logging "github.com/ipfs/go-log/v2"
 	"golang.org/x/xerrors"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+var log = logging.Logger("apiwrapper")
+
 type fsInfo struct {
 	stores.ID
 	sectors []stores.Decl
 	stat    fsutil.FsStat
+	statErr error
 }
 
 type LotusAPIWrapper struct {
 	api.FullNode
 	api.StorageMiner
+
+	tracker *tracker.Tracker
+
+	lk         sync.Mutex
+	runwayOpts RunwayOptions
+	spends     map[address.Address]*spendTracker
 }
 
 func NewLotusAPIWrapper(fullNode api.FullNode, storageMiner api.StorageMiner) *LotusAPIWrapper {
-	return &LotusAPIWrapper{FullNode: fullNode, StorageMiner: storageMiner}
+	return &LotusAPIWrapper{FullNode: fullNode, StorageMiner: storageMiner,
+		runwayOpts: DefaultRunwayOptions(),
+		spends:     make(map[address.Address]*spendTracker),
+	}
+}
+
+// SetTracker 设置后 WorkerTaskInfo 会记录任务耗时, WorkerTaskInfo 和 AnnotatedWorkerTaskInfo 会标记超出基准耗时的任务
+func (c *LotusAPIWrapper) SetTracker(t *tracker.Tracker) {
+	c.tracker = t
 }
 
 func (c *LotusAPIWrapper) MinerProvingInfo(ctx context.Context, mAddr address.Address) (*apitypes.ProvingInfo, error) {
@@ -69,6 +87,7 @@ func (c *LotusAPIWrapper) MinerProvingInfo(ctx context.Context, mAddr address.Ad
 	faults := uint64(0)
 	recovering := uint64(0)
 	curDeadlineSectors := uint64(0)
+	curDeadlineFaults := uint64(0)
 
 	if err := mas.ForEachDeadline(func(dlIdx uint64, dl miner.Deadline) error {
 		return dl.ForEachPartition(func(partIdx uint64, part miner.Partition) error {
@@ -89,6 +108,9 @@ func (c *LotusAPIWrapper) MinerProvingInfo(ctx context.Context, mAddr address.Ad
 				return err
 			} else {
 				faults += count
+				if dlIdx == cd.Index {
+					curDeadlineFaults += count
+				}
 			}
 
 			if bf, err := part.RecoveringSectors(); err != nil {
@@ -105,28 +127,42 @@ func (c *LotusAPIWrapper) MinerProvingInfo(ctx context.Context, mAddr address.Ad
 		return nil, xerrors.Errorf("walking miner deadlines and partitions: %w", err)
 	}
 
-	var faultPerc float64
+	var faultRatio float64
 	if proving > 0 {
-		faultPerc = float64(faults*10000/proving) / 100
+		faultRatio = float64(faults) / float64(proving)
 	}
 
 	return &apitypes.ProvingInfo{
-		CurrentEpoch:          cd.CurrentEpoch,
-		ProvingPeriodBoundary: cd.PeriodStart % cd.WPoStProvingPeriod,
-		ProvingPeriodStart:    cli.EpochTime(cd.CurrentEpoch, cd.PeriodStart),
-		NextPeriodStart:       cli.EpochTime(cd.CurrentEpoch, cd.PeriodStart+cd.WPoStProvingPeriod),
-		Faults:                fmt.Sprintf("%d (%.2f%%)", faults, faultPerc),
-		Recovering:            recovering,
-		DeadlineIndex:         cd.Index,
-		DeadlineSectors:       curDeadlineSectors,
-		DeadlineOpen:          cli.EpochTime(cd.CurrentEpoch, cd.Open),
-		DeadlineClose:         cli.EpochTime(cd.CurrentEpoch, cd.Close),
-		DeadlineElapsed:       durafmt.Parse(time.Second * time.Duration(int64(build.BlockDelaySecs)*int64(cd.Close-cd.Open))).LimitFirstN(2).String(),
-		DeadlineChallenge:     cli.EpochTime(cd.CurrentEpoch, cd.Challenge),
-		DeadlineFaultCutoff:   cli.EpochTime(cd.CurrentEpoch, cd.FaultCutoff),
+		CurrentEpoch:            cd.CurrentEpoch,
+		ProvingPeriodBoundary:   cd.PeriodStart % cd.WPoStProvingPeriod,
+		ProvingPeriodStart:      cd.PeriodStart,
+		ProvingPeriodStartTime:  epochTime(head, cd.PeriodStart).Unix(),
+		NextPeriodStart:         cd.PeriodStart + cd.WPoStProvingPeriod,
+		NextPeriodStartTime:     epochTime(head, cd.PeriodStart+cd.WPoStProvingPeriod).Unix(),
+		LiveSectors:             proving,
+		Faults:                  faults,
+		FaultRatio:              faultRatio,
+		Recovering:              recovering,
+		DeadlineIndex:           cd.Index,
+		DeadlineSectors:         curDeadlineSectors,
+		DeadlineFaults:          curDeadlineFaults,
+		DeadlineOpen:            cd.Open,
+		DeadlineOpenTime:        epochTime(head, cd.Open).Unix(),
+		DeadlineClose:           cd.Close,
+		DeadlineCloseTime:       epochTime(head, cd.Close).Unix(),
+		DeadlineDuration:        int64(build.BlockDelaySecs) * int64(cd.Close-cd.Open),
+		DeadlineChallenge:       cd.Challenge,
+		DeadlineChallengeTime:   epochTime(head, cd.Challenge).Unix(),
+		DeadlineFaultCutoff:     cd.FaultCutoff,
+		DeadlineFaultCutoffTime: epochTime(head, cd.FaultCutoff).Unix(),
 	}, nil
 }
 
+// epochTime 按出块间隔估算高度对应的时间
+func epochTime(head *types.TipSet, e abi.ChainEpoch) time.Time {
+	return time.Unix(int64(head.MinTimestamp())+int64(e-head.Height())*int64(build.BlockDelaySecs), 0)
+}
+
 func (c *LotusAPIWrapper) MinerAssetInfo(ctx context.Context, mAddr address.Address) (*apitypes.ClusterAssetInfo, error) {
 	nodeApi := c.FullNode
 	mi, err := nodeApi.StateMinerInfo(ctx, mAddr, types.EmptyTSK)
@@ -170,7 +206,23 @@ func (c *LotusAPIWrapper) MinerAssetInfo(ctx context.Context, mAddr address.Addr
 	if err != nil {
 		return nil, err
 	}
-	return &apitypes.ClusterAssetInfo{
+	mb, err := nodeApi.StateMarketBalance(ctx, mAddr, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting market balance: %w", err)
+	}
+	postID, err := nodeApi.StateLookupID(ctx, postAddr, types.EmptyTSK)
+	if err != nil {
+		return nil, err
+	}
+	controls, err := c.controlAddresses(ctx, mi, postID)
+	if err != nil {
+		return nil, err
+	}
+	pendingOwner, err := pendingOwner(ctx, tbs, mAct)
+	if err != nil {
+		return nil, err
+	}
+	cai := &apitypes.ClusterAssetInfo{
 		MinerID:                  mAddr.String(),
 		MinerBalance:             mAct.Balance,
 		VestingFunds:             lockedFunds.VestingFunds,
@@ -181,7 +233,16 @@ func (c *LotusAPIWrapper) MinerAssetInfo(ctx context.Context, mAddr address.Addr
 		WorkerBalance:            wBls,
 		QualityAdjPower:          power.MinerPower.QualityAdjPower,
 		OwnerBalance:             ownerBls,
-	}, nil
+		ControlAddresses:         controls,
+		MarketEscrow:             mb.Escrow,
+		MarketLocked:             mb.Locked,
+		PendingOwner:             pendingOwner,
+	}
+	if mi.NewWorker != address.Undef {
+		cai.PendingWorker = mi.NewWorker.String()
+		cai.WorkerChangeEpoch = mi.WorkerChangeEpoch
+	}
+	return cai, nil
 }
 
 // 扇区信息
@@ -211,8 +272,36 @@ func (c *LotusAPIWrapper) SectorsInfo() (*apitypes.MinerSectorsInfo, error) {
 	return msi, nil
 }
 
-// worker任务信息
+// worker任务信息. 设置了 tracker 时作为一次采集计入耗时样本, 只应由定期采集调用
 func (c *LotusAPIWrapper) WorkerTaskInfo() ([]*apitypes.WorkerTaskState, error) {
+	now := time.Now()
+	wtStates, err := c.workerTaskStates(now)
+	if err != nil {
+		return nil, err
+	}
+	if c.tracker != nil {
+		if err := c.tracker.Observe(wtStates, now); err != nil {
+			return nil, err
+		}
+	}
+	return wtStates, nil
+}
+
+// AnnotatedWorkerTaskInfo worker任务信息, 只标记基准耗时和是否卡住, 不更新 tracker. 供按需查询使用,
+// 避免查询频率影响学习到的耗时
+func (c *LotusAPIWrapper) AnnotatedWorkerTaskInfo() ([]*apitypes.WorkerTaskState, error) {
+	now := time.Now()
+	wtStates, err := c.workerTaskStates(now)
+	if err != nil {
+		return nil, err
+	}
+	if c.tracker != nil {
+		c.tracker.Annotate(wtStates, now)
+	}
+	return wtStates, nil
+}
+
+func (c *LotusAPIWrapper) workerTaskStates(now time.Time) ([]*apitypes.WorkerTaskState, error) {
 	minerAPI := c.StorageMiner
 	ctx := context.Background()
 
@@ -243,6 +332,9 @@ func (c *LotusAPIWrapper) WorkerTaskInfo() ([]*apitypes.WorkerTaskState, error)
 				Start:     job.Start,
 				RunWait:   job.RunWait,
 			}
+			if job.RunWait == 0 {
+				ss.TaskTime = int64(now.Sub(job.Start) / time.Second)
+			}
 			ss.Task = strings.TrimSpace(job.Task.Short())
 			wts.SectorStates = append(wts.SectorStates, ss)
 		}
@@ -251,6 +343,62 @@ func (c *LotusAPIWrapper) WorkerTaskInfo() ([]*apitypes.WorkerTaskState, error)
 	return wtStates, nil
 }
 
+// TrackSectors 采集一次worker任务, 并轮询正在封装的扇区状态, 写入扇区时间线. 需要先 SetTracker
+func (c *LotusAPIWrapper) TrackSectors(ctx context.Context) error {
+	if c.tracker == nil {
+		return xerrors.New("tracker not set")
+	}
+	if _, err := c.WorkerTaskInfo(); err != nil {
+		return xerrors.Errorf("getting worker jobs: %w", err)
+	}
+
+	now := time.Now()
+	// 查询失败时才加载矿工的扇区列表, 判断扇区是否已不存在
+	var existing map[abi.SectorNumber]struct{}
+	for _, sector := range c.tracker.ActiveSectors() {
+		si, err := c.StorageMiner.SectorsStatus(ctx, abi.SectorNumber(sector), false)
+		if err != nil {
+			if existing == nil {
+				var lerr error
+				if existing, lerr = c.sectorSet(ctx); lerr != nil {
+					log.Warnf("listing sectors: %s", lerr)
+				}
+			}
+			if _, ok := existing[abi.SectorNumber(sector)]; existing != nil && !ok {
+				log.Infof("sector %d no longer exists, stop tracking it", sector)
+				c.tracker.ForgetSector(sector)
+				continue
+			}
+			log.Warnf("getting sector %d status: %s", sector, err)
+			continue
+		}
+		if err := c.tracker.ObserveState(sector, string(si.State), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *LotusAPIWrapper) sectorSet(ctx context.Context) (map[abi.SectorNumber]struct{}, error) {
+	sectors, err := c.StorageMiner.SectorsList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[abi.SectorNumber]struct{}, len(sectors))
+	for _, s := range sectors {
+		set[s] = struct{}{}
+	}
+	return set, nil
+}
+
+// 扇区生命周期时间线
+func (c *LotusAPIWrapper) SectorTimeline(sector abi.SectorNumber) (*apitypes.SectorTimeline, error) {
+	if c.tracker == nil {
+		return nil, xerrors.New("tracker not set")
+	}
+	return c.tracker.Timeline(uint64(sector))
+}
+
 func (c *LotusAPIWrapper) GetStorageInfo() ([]*apitypes.StorageInfo, error) {
 	minerAPI := c.StorageMiner
 	ctx := context.Background()
@@ -269,11 +417,12 @@ func (c *LotusAPIWrapper) GetStorageInfo() ([]*apitypes.StorageInfo, error) {
 	for id, decls := range st {
 		st, err := minerAPI.StorageStat(ctx, id)
 		if err != nil {
-			sorted = append(sorted, &fsInfo{ID: id, sectors: decls})
+			log.Warnf("stat storage %s: %s", id, err)
+			sorted = append(sorted, &fsInfo{ID: id, sectors: decls, statErr: err})
 			continue
 		}
 
-		sorted = append(sorted, &fsInfo{id, decls, st})
+		sorted = append(sorted, &fsInfo{ID: id, sectors: decls, stat: st})
 	}
 
 	sort.Slice(sorted, func(i, j int) bool {
@@ -302,6 +451,9 @@ func (c *LotusAPIWrapper) GetStorageInfo() ([]*apitypes.StorageInfo, error) {
 			CanStore:  info.CanStore,
 			Local:     local[fs.ID],
 		}
+		if fs.statErr != nil {
+			storageInfos[i].StatError = fs.statErr.Error()
+		}
 
 		for j, sector := range fs.sectors {
 			storageInfos[i].Sectors[j] = &apitypes.Decl{
@@ -11,7 +11,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
 	"github.com/guoxiaopeng875/lotus-adapter/apiwrapper"
+	"github.com/guoxiaopeng875/lotus-adapter/tracker"
 	"github.com/patrickmn/go-cache"
+	"golang.org/x/xerrors"
+	"sync"
 	"time"
 
 	"github.com/filecoin-project/go-address"
@@ -19,9 +22,12 @@ import (
 	"github.com/filecoin-project/lotus/chain/types"
 )
 
-func NewCachedFullNode(nodeApi api.FullNode, minerApi api.StorageMiner, cache *cache.Cache, secret *dtypes.APIAlg) *CachedFullNode {
+func NewCachedFullNode(nodeApi api.FullNode, minerApi api.StorageMiner, cache *cache.Cache, secret *dtypes.APIAlg, tk *tracker.Tracker) *CachedFullNode {
+	wrapper := apiwrapper.NewLotusAPIWrapper(nodeApi, minerApi)
+	wrapper.SetTracker(tk)
 	return &CachedFullNode{nodeApi: nodeApi, minerApi: minerApi, cache: cache, APISecret: secret,
-		wrapper: apiwrapper.NewLotusAPIWrapper(nodeApi, minerApi),
+		wrapper: wrapper,
+		runways: make(map[address.Address]*apitypes.RunwayInfo),
 	}
 }
 
@@ -31,6 +37,9 @@ type CachedFullNode struct {
 	minerApi  api.StorageMiner
 	cache     *cache.Cache
 	wrapper   *apiwrapper.LotusAPIWrapper
+	// trackRunway 最近一次估算的余额可维持天数, 还没有结果时为nil
+	runwayLk sync.Mutex
+	runways  map[address.Address]*apitypes.RunwayInfo
 }
 
 func (c *CachedFullNode) AuthVerify(_ context.Context, token string) ([]auth.Permission, error) {
@@ -51,6 +60,61 @@ func (c *CachedFullNode) MinerProvingInfo(ctx context.Context, miner address.Add
 	return info, nil
 }
 
+func (c *CachedFullNode) MinerDeadlines(ctx context.Context, miner address.Address) (*apitypes.DeadlinesInfo, error) {
+	k := fmt.Sprintf("MinerDeadlines:%s", miner.String())
+	cachedData, exist := c.cache.Get(k)
+	if exist {
+		return cachedData.(*apitypes.DeadlinesInfo), nil
+	}
+	info, err := c.wrapper.MinerDeadlines(ctx, miner)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.SetDefault(k, info)
+	return info, nil
+}
+
+// MinerRunway 返回后台最近一次估算的结果, 首次估算需要遍历一天的链上消息, 不在请求中计算
+func (c *CachedFullNode) MinerRunway(ctx context.Context, miner address.Address) (*apitypes.RunwayInfo, error) {
+	c.runwayLk.Lock()
+	defer c.runwayLk.Unlock()
+	info, ok := c.runways[miner]
+	if !ok {
+		return nil, xerrors.Errorf("runway of %s is not tracked by this gateway", miner)
+	}
+	if info == nil {
+		return nil, xerrors.Errorf("runway of %s is not ready yet, try again later", miner)
+	}
+	return info, nil
+}
+
+// trackRunway 在后台定期估算矿工控制地址余额可维持的天数, 失败时保留上一次的结果
+func (c *CachedFullNode) trackRunway(ctx context.Context, miner address.Address, interval time.Duration) {
+	c.runwayLk.Lock()
+	c.runways[miner] = nil
+	c.runwayLk.Unlock()
+
+	go func() {
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			info, err := c.wrapper.MinerRunway(ctx, miner)
+			if err != nil {
+				log.Warnf("estimating runway of %s: %s", miner, err)
+			} else {
+				c.runwayLk.Lock()
+				c.runways[miner] = info
+				c.runwayLk.Unlock()
+			}
+			select {
+			case <-tick.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
 func (c *CachedFullNode) SectorsStatus(ctx context.Context, sid abi.SectorNumber, showOnChainInfo bool) (api.SectorInfo, error) {
 	k := fmt.Sprintf("SectorsStatus%d", sid)
 	cachedData, exist := c.cache.Get(k)
@@ -107,6 +171,25 @@ func (c *CachedFullNode) WorkerJobs(ctx context.Context) (map[uuid.UUID][]storif
 	return info, nil
 }
 
+// worker任务信息只标记卡住的任务, 耗时样本由 trackTasks 定期采集
+func (c *CachedFullNode) WorkerTaskInfo(ctx context.Context) ([]*apitypes.WorkerTaskState, error) {
+	const k = "WorkerTaskInfo"
+	cachedData, exist := c.cache.Get(k)
+	if exist {
+		return cachedData.([]*apitypes.WorkerTaskState), nil
+	}
+	info, err := c.wrapper.AnnotatedWorkerTaskInfo()
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Set(k, info, time.Second)
+	return info, nil
+}
+
+func (c *CachedFullNode) SectorTimeline(ctx context.Context, sid abi.SectorNumber) (*apitypes.SectorTimeline, error) {
+	return c.wrapper.SectorTimeline(sid)
+}
+
 func (c *CachedFullNode) MinerAssetInfo(ctx context.Context, mAddr address.Address) (*apitypes.ClusterAssetInfo, error) {
 	k := fmt.Sprintf("MinerAssetInfo:%s", mAddr.String())
 	cachedData, exist := c.cache.Get(k)
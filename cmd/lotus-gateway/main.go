@@ -8,7 +8,11 @@ import (
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/node/repo"
 	"github.com/gorilla/mux"
+	"github.com/guoxiaopeng875/lotus-adapter/apiwrapper"
 	lcli "github.com/guoxiaopeng875/lotus-adapter/cmd/cli"
+	"github.com/guoxiaopeng875/lotus-adapter/tracker"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/patrickmn/go-cache"
 	"github.com/urfave/cli/v2"
@@ -81,6 +85,11 @@ var runCmd = &cli.Command{
 			Usage: "set cache cleanup interval",
 			Value: time.Minute,
 		},
+		&cli.DurationFlag{
+			Name:  "track-interval",
+			Usage: "how often worker jobs and sealing sector states are polled to learn task durations and record sector timelines, and runway is re-estimated",
+			Value: time.Minute,
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		log.Info("Starting lotus gateway")
@@ -125,7 +134,21 @@ var runCmd = &cli.Command{
 			return err
 		}
 		log.Info(string(data))
-		gwAPI := NewCachedFullNode(api, minerApi, c, secret)
+		mds, err := ks.Datastore("/metadata")
+		if err != nil {
+			return err
+		}
+		tk, err := tracker.New(namespace.Wrap(mds, datastore.NewKey("/tracker")), tracker.DefaultOptions())
+		if err != nil {
+			return err
+		}
+		gwAPI := NewCachedFullNode(api, minerApi, c, secret, tk)
+		go trackTasks(ctx, gwAPI.wrapper, cctx.Duration("track-interval"))
+		mAddr, err := minerApi.ActorAddress(ctx)
+		if err != nil {
+			return err
+		}
+		gwAPI.trackRunway(ctx, mAddr, cctx.Duration("track-interval"))
 		rpcServer.Register("Filecoin", gwAPI)
 
 		mux.Handle("/rpc/v0", rpcServer)
@@ -157,3 +180,19 @@ var runCmd = &cli.Command{
 		return srv.Serve(nl)
 	},
 }
+
+// trackTasks 定期拉取worker任务和封装中扇区的状态, 让 tracker 学习任务耗时并记录扇区时间线
+func trackTasks(ctx context.Context, wrapper *apiwrapper.LotusAPIWrapper, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := wrapper.TrackSectors(ctx); err != nil {
+				log.Warnf("tracking sectors: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/docker/go-units"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"golang.org/x/xerrors"
+	"gopkg.in/resty.v1"
+)
+
+// 告警规则类型
+const (
+	// 账户余额低于 threshold(FIL), account 可选 worker, owner, post, available
+	RuleBalanceBelow = "balance_below"
+	// 错误扇区比例高于 threshold(百分比)
+	RuleFaultRatioAbove = "fault_ratio_above"
+	// 存储路径可用空间低于 threshold, 如 "500GiB"
+	RuleStorageAvailableBelow = "storage_available_below"
+	// 可存储(CanStore)的路径按最近的使用速度估算在 threshold 天内写满
+	RuleStorageFullWithin = "storage_full_within"
+	// 控制地址余额按最近的花费估算在 threshold 天内降到安全余额以下, 可用 account 只检查某种角色(owner/worker/control)
+	RuleRunwayBelow = "runway_below"
+	// 存储路径 StorageStat 失败
+	RuleStorageStatFailed = "storage_stat_failed"
+	// 当前打开的deadline中存在错误扇区
+	RuleDeadlineFaults = "deadline_faults"
+	// worker被禁用
+	RuleWorkerDisabled = "worker_disabled"
+	// 任务运行时间超过 threshold, 如 "6h", 可用 task 只检查某类任务
+	RuleJobRunningLonger = "job_running_longer"
+	// 任务运行时间超过其历史基准耗时的若干倍, 可用 task 只检查某类任务
+	RuleJobStuck = "job_stuck"
+)
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// 通知失败时最多缓存的告警数
+const maxPendingAlerts = 1000
+
+type AlertRule struct {
+	Name      string
+	Type      string
+	Account   string
+	Task      string
+	Threshold string
+
+	fil      types.BigInt
+	ratio    float64
+	size     int64
+	days     float64
+	duration time.Duration
+}
+
+type AlertConfig struct {
+	// 同一告警重复通知的间隔, 为空时只在触发和恢复时各通知一次
+	RepeatInterval string
+	Rules          []*AlertRule `toml:"rule"`
+
+	repeat time.Duration
+}
+
+// 规则文件示例:
+//
+//	RepeatInterval = "4h"
+//
+//	[[rule]]
+//	Type = "balance_below"
+//	Account = "worker"
+//	Threshold = "20"
+//
+//	[[rule]]
+//	Name = "pc2-stuck"
+//	Type = "job_running_longer"
+//	Task = "PC2"
+//	Threshold = "2h"
+//
+//	[[rule]]
+//	Type = "storage_full_within"
+//	Threshold = "7"
+func LoadAlertConfig(path string) (*AlertConfig, error) {
+	var cfg AlertConfig
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		return nil, xerrors.Errorf("decoding alert rules %s: %w", path, err)
+	}
+	if err := cfg.init(); err != nil {
+		return nil, xerrors.Errorf("alert rules %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func (c *AlertConfig) init() error {
+	if c.RepeatInterval != "" {
+		d, err := time.ParseDuration(c.RepeatInterval)
+		if err != nil {
+			return xerrors.Errorf("parsing RepeatInterval: %w", err)
+		}
+		c.repeat = d
+	}
+	names := map[string]struct{}{}
+	for i, r := range c.Rules {
+		if r.Name == "" {
+			r.Name = r.Type
+		}
+		if _, ok := names[r.Name]; ok {
+			return xerrors.Errorf("rule %d: duplicate rule name %s", i, r.Name)
+		}
+		names[r.Name] = struct{}{}
+		if err := r.init(); err != nil {
+			return xerrors.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *AlertRule) init() error {
+	var err error
+	switch r.Type {
+	case RuleBalanceBelow:
+		switch r.Account {
+		case "worker", "owner", "post", "available":
+		default:
+			return xerrors.Errorf("unknown account %q", r.Account)
+		}
+		var fil types.FIL
+		fil, err = types.ParseFIL(r.Threshold)
+		r.fil = types.BigInt(fil)
+	case RuleFaultRatioAbove:
+		_, err = fmt.Sscanf(r.Threshold, "%g", &r.ratio)
+	case RuleStorageAvailableBelow:
+		r.size, err = units.RAMInBytes(r.Threshold)
+	case RuleRunwayBelow:
+		switch r.Account {
+		case "", "owner", "worker", "control":
+		default:
+			return xerrors.Errorf("unknown account %q", r.Account)
+		}
+		_, err = fmt.Sscanf(r.Threshold, "%g", &r.days)
+	case RuleStorageFullWithin:
+		_, err = fmt.Sscanf(r.Threshold, "%g", &r.days)
+	case RuleJobRunningLonger:
+		r.duration, err = time.ParseDuration(r.Threshold)
+	case RuleStorageStatFailed, RuleDeadlineFaults, RuleWorkerDisabled, RuleJobStuck:
+	default:
+		return xerrors.Errorf("unknown rule type %q", r.Type)
+	}
+	if err != nil {
+		return xerrors.Errorf("parsing threshold %q: %w", r.Threshold, err)
+	}
+	return nil
+}
+
+type Alert struct {
+	Rule    string `json:"rule"`
+	MinerID string `json:"miner_id"`
+	// 告警对象, 如workerID, 存储ID
+	Subject  string     `json:"subject"`
+	Status   string     `json:"status"`
+	Message  string     `json:"message"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+func (a *Alert) fingerprint() string {
+	return a.Rule + "/" + a.MinerID + "/" + a.Subject
+}
+
+type activeAlert struct {
+	alert        *Alert
+	lastNotified time.Time
+}
+
+type Alerter struct {
+	cfg     *AlertConfig
+	cli     *resty.Client
+	webhook string
+	// fingerprint: 正在触发的告警
+	active  map[string]*activeAlert
+	pending []*Alert
+}
+
+func NewAlerter(cfg *AlertConfig, cli *resty.Client, webhook string) *Alerter {
+	return &Alerter{cfg: cfg, cli: cli, webhook: webhook, active: make(map[string]*activeAlert)}
+}
+
+// Process 计算规则并把需要通知的告警发送到webhook, 发送失败的告警下次重试
+func (a *Alerter) Process(mis []*apitypes.PushedMinerInfo, now time.Time) error {
+	a.pending = append(a.pending, a.Evaluate(mis, now)...)
+	if len(a.pending) > maxPendingAlerts {
+		a.pending = a.pending[len(a.pending)-maxPendingAlerts:]
+	}
+	if len(a.pending) == 0 {
+		return nil
+	}
+	if err := a.notify(a.pending); err != nil {
+		return err
+	}
+	a.pending = nil
+	return nil
+}
+
+// Evaluate 计算规则, 返回需要通知的告警: 新触发的, 到了重复通知间隔的, 以及已恢复的
+func (a *Alerter) Evaluate(mis []*apitypes.PushedMinerInfo, now time.Time) []*Alert {
+	firing := map[string]*Alert{}
+	for _, mi := range mis {
+		for _, r := range a.cfg.Rules {
+			for _, al := range r.evaluate(mi, now) {
+				firing[al.fingerprint()] = al
+			}
+		}
+	}
+
+	var out []*Alert
+	for fp, al := range firing {
+		act, ok := a.active[fp]
+		if !ok {
+			al.Status = AlertFiring
+			al.StartsAt = now
+			a.active[fp] = &activeAlert{alert: al, lastNotified: now}
+			out = append(out, al)
+			continue
+		}
+		// 保留首次触发时间, 消息更新为最新的值
+		act.alert.Message = al.Message
+		if a.cfg.repeat > 0 && now.Sub(act.lastNotified) >= a.cfg.repeat {
+			act.lastNotified = now
+			out = append(out, act.alert)
+		}
+	}
+	for fp, act := range a.active {
+		if _, ok := firing[fp]; ok {
+			continue
+		}
+		resolved := *act.alert
+		resolved.Status = AlertResolved
+		end := now
+		resolved.EndsAt = &end
+		out = append(out, &resolved)
+		delete(a.active, fp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].fingerprint() < out[j].fingerprint()
+	})
+	return out
+}
+
+func (a *Alerter) notify(alerts []*Alert) error {
+	resp, err := a.cli.R().SetBody(alerts).Post(a.webhook)
+	if err != nil {
+		return xerrors.Errorf("sending alerts: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return xerrors.Errorf("sending alerts, url:%s, respStatus:%d, resBody:%s", a.webhook, resp.StatusCode(), string(resp.Body()))
+	}
+	return nil
+}
+
+func (r *AlertRule) evaluate(mi *apitypes.PushedMinerInfo, now time.Time) []*Alert {
+	newAlert := func(subject, format string, args ...interface{}) *Alert {
+		return &Alert{
+			Rule:    r.Name,
+			MinerID: mi.MinerID,
+			Subject: subject,
+			Message: fmt.Sprintf(format, args...),
+		}
+	}
+
+	var out []*Alert
+	switch r.Type {
+	case RuleBalanceBelow:
+		cai := mi.ClusterAssetInfo
+		if cai == nil {
+			return nil
+		}
+		var bal big.Int
+		switch r.Account {
+		case "worker":
+			bal = cai.WorkerBalance
+		case "owner":
+			bal = cai.OwnerBalance
+		case "post":
+			bal = cai.PostBalance
+		case "available":
+			bal = cai.AvailableBalance
+		}
+		if bal.Int != nil && bal.LessThan(r.fil) {
+			out = append(out, newAlert(r.Account, "%s balance %s is below %s", r.Account, types.FIL(bal), types.FIL(r.fil)))
+		}
+	case RuleFaultRatioAbove:
+		pi := mi.ProvingInfo
+		if pi == nil {
+			return nil
+		}
+		if perc := pi.FaultRatio * 100; perc > r.ratio {
+			out = append(out, newAlert("faults", "%d faulty sectors (%.2f%%) exceeds %.2f%%", pi.Faults, perc, r.ratio))
+		}
+	case RuleStorageAvailableBelow:
+		for _, si := range mi.StorageInfo {
+			// 获取容量失败的路径没有可比较的数据
+			if si.Capacity == 0 {
+				continue
+			}
+			if si.Available < r.size {
+				out = append(out, newAlert(si.ID, "storage %s (%s) available %s is below %s",
+					si.ID, si.Local, units.BytesSize(float64(si.Available)), units.BytesSize(float64(r.size))))
+			}
+		}
+	case RuleStorageFullWithin:
+		for _, si := range mi.StorageInfo {
+			if !si.CanStore || si.DaysUntilFull == nil {
+				continue
+			}
+			if *si.DaysUntilFull < r.days {
+				out = append(out, newAlert(si.ID, "storage %s (%s) will be full in %.1f days, using %s per day",
+					si.ID, si.Local, *si.DaysUntilFull, units.BytesSize(float64(si.UsageRate))))
+			}
+		}
+	case RuleRunwayBelow:
+		if mi.Runway == nil {
+			return nil
+		}
+		for _, ar := range mi.Runway.Addresses {
+			if ar.DaysLeft == nil || *ar.DaysLeft >= r.days || (r.Account != "" && !hasRole(ar.Roles, r.Account)) {
+				continue
+			}
+			out = append(out, newAlert(ar.Address, "%s (%s) balance %s reaches %s in %.1f days, spending %s per day",
+				ar.Address, strings.Join(ar.Roles, ","), types.FIL(ar.Balance), types.FIL(mi.Runway.SafeBalance), *ar.DaysLeft, types.FIL(ar.DailySpend)))
+		}
+	case RuleStorageStatFailed:
+		for _, si := range mi.StorageInfo {
+			if si.StatError != "" {
+				out = append(out, newAlert(si.ID, "storage %s (%s) stat failed: %s", si.ID, si.Local, si.StatError))
+			}
+		}
+	case RuleDeadlineFaults:
+		pi := mi.ProvingInfo
+		if pi == nil || pi.DeadlineFaults == 0 {
+			return nil
+		}
+		out = append(out, newAlert(fmt.Sprintf("deadline-%d", pi.DeadlineIndex),
+			"open deadline %d has %d faulty sectors of %d", pi.DeadlineIndex, pi.DeadlineFaults, pi.DeadlineSectors))
+	case RuleWorkerDisabled:
+		for _, w := range mi.WorkerTaskState {
+			if !w.Enable {
+				out = append(out, newAlert(w.ID, "worker %s (%s) is disabled", w.ID, w.Hostname))
+			}
+		}
+	case RuleJobRunningLonger:
+		for _, w := range mi.WorkerTaskState {
+			for _, ss := range w.SectorStates {
+				if ss.RunWait != 0 || (r.Task != "" && r.Task != ss.Task) {
+					continue
+				}
+				if elapsed := now.Sub(ss.Start); elapsed > r.duration {
+					out = append(out, newAlert(fmt.Sprintf("%s/%s/%d", w.ID, ss.Task, ss.SectorNum),
+						"%s of sector %d on %s has been running for %s", ss.Task, ss.SectorNum, w.Hostname, elapsed.Truncate(time.Minute)))
+				}
+			}
+		}
+	case RuleJobStuck:
+		for _, w := range mi.WorkerTaskState {
+			for _, ss := range w.SectorStates {
+				if !ss.Stuck || (r.Task != "" && r.Task != ss.Task) {
+					continue
+				}
+				out = append(out, newAlert(fmt.Sprintf("%s/%s/%d", w.ID, ss.Task, ss.SectorNum),
+					"%s of sector %d on %s has been running for %s, baseline %s", ss.Task, ss.SectorNum, w.Hostname,
+					time.Duration(ss.TaskTime)*time.Second, time.Duration(ss.Baseline)*time.Second))
+			}
+		}
+	}
+	return out
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlerterEvaluate(t *testing.T) {
+	cfg := &AlertConfig{
+		RepeatInterval: "1h",
+		Rules: []*AlertRule{
+			{Type: RuleBalanceBelow, Account: "worker", Threshold: "10"},
+			{Type: RuleWorkerDisabled},
+			{Name: "pc2-stuck", Type: RuleJobRunningLonger, Task: "PC2", Threshold: "2h"},
+		},
+	}
+	require.NoError(t, cfg.init())
+	a := NewAlerter(cfg, nil, "")
+
+	now := time.Now()
+	mi := &apitypes.PushedMinerInfo{
+		MinerID: "f01000",
+		ClusterAssetInfo: &apitypes.ClusterAssetInfo{
+			WorkerBalance: types.BigInt(types.MustParseFIL("5")),
+		},
+		WorkerTaskState: []*apitypes.WorkerTaskState{
+			{ID: "w1", Hostname: "h1", Enable: false},
+			{ID: "w2", Hostname: "h2", Enable: true, SectorStates: []*apitypes.SectorState{
+				{Task: "PC2", SectorNum: 1, Start: now.Add(-3 * time.Hour)},
+				{Task: "PC1", SectorNum: 2, Start: now.Add(-3 * time.Hour)},
+			}},
+		},
+	}
+
+	out := a.Evaluate([]*apitypes.PushedMinerInfo{mi}, now)
+	require.Len(t, out, 3)
+	for _, al := range out {
+		require.Equal(t, AlertFiring, al.Status)
+	}
+	require.Equal(t, "balance_below", out[0].Rule)
+	require.Equal(t, "pc2-stuck", out[1].Rule)
+	require.Equal(t, "w2/PC2/1", out[1].Subject)
+	require.Equal(t, "worker_disabled", out[2].Rule)
+
+	// 仍在触发的告警在重复间隔内不再通知
+	require.Empty(t, a.Evaluate([]*apitypes.PushedMinerInfo{mi}, now.Add(time.Minute)))
+	require.Len(t, a.Evaluate([]*apitypes.PushedMinerInfo{mi}, now.Add(time.Hour)), 3)
+
+	// worker恢复后发送恢复通知
+	mi.WorkerTaskState[0].Enable = true
+	out = a.Evaluate([]*apitypes.PushedMinerInfo{mi}, now.Add(time.Hour+time.Minute))
+	require.Len(t, out, 1)
+	require.Equal(t, "worker_disabled", out[0].Rule)
+	require.Equal(t, AlertResolved, out[0].Status)
+	require.Equal(t, now, out[0].StartsAt)
+	require.NotNil(t, out[0].EndsAt)
+}
+
+func TestFaultRatioRule(t *testing.T) {
+	cfg := &AlertConfig{Rules: []*AlertRule{{Type: RuleFaultRatioAbove, Threshold: "1"}}}
+	require.NoError(t, cfg.init())
+	a := NewAlerter(cfg, nil, "")
+
+	mi := &apitypes.PushedMinerInfo{
+		MinerID:     "f01000",
+		ProvingInfo: &apitypes.ProvingInfo{LiveSectors: 1000, Faults: 5, FaultRatio: 0.005},
+	}
+	require.Empty(t, a.Evaluate([]*apitypes.PushedMinerInfo{mi}, time.Now()))
+
+	mi.ProvingInfo.Faults, mi.ProvingInfo.FaultRatio = 20, 0.02
+	out := a.Evaluate([]*apitypes.PushedMinerInfo{mi}, time.Now())
+	require.Len(t, out, 1)
+	require.Equal(t, "20 faulty sectors (2.00%) exceeds 1.00%", out[0].Message)
+}
+
+func TestRunwayRule(t *testing.T) {
+	cfg := &AlertConfig{Rules: []*AlertRule{{Type: RuleRunwayBelow, Account: "worker", Threshold: "3"}}}
+	require.NoError(t, cfg.init())
+
+	days := func(d float64) *float64 { return &d }
+	mi := &apitypes.PushedMinerInfo{
+		MinerID: "f01000",
+		Runway: &apitypes.RunwayInfo{
+			SafeBalance: types.FromFil(1),
+			Addresses: []*apitypes.AddressRunway{
+				{Address: "f01001", Roles: []string{"owner"}, Balance: types.FromFil(2), DailySpend: types.FromFil(1), DaysLeft: days(1)},
+				{Address: "f01002", Roles: []string{"worker"}, Balance: types.FromFil(3), DailySpend: types.FromFil(1), DaysLeft: days(2)},
+				{Address: "f01003", Roles: []string{"worker", "control"}, Balance: types.FromFil(100), DailySpend: types.FromFil(1), DaysLeft: days(99)},
+			},
+		},
+	}
+	out := NewAlerter(cfg, nil, "").Evaluate([]*apitypes.PushedMinerInfo{mi}, time.Now())
+	require.Len(t, out, 1)
+	require.Equal(t, "f01002", out[0].Subject)
+	require.Equal(t, "f01002 (worker) balance 3 FIL reaches 1 FIL in 2.0 days, spending 1 FIL per day", out[0].Message)
+}
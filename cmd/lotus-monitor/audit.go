@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/guoxiaopeng875/lotus-adapter/apiwrapper"
+	lcli "github.com/guoxiaopeng875/lotus-adapter/cmd/cli"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+var auditCmd = &cli.Command{
+	Name:  "audit",
+	Usage: "Check storage declarations against the sector list and live on-chain sectors",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output format: table or json",
+			Value: "table",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := lcli.ReqContext(cctx)
+
+		api, closer, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		minerApi, mCloser, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer mCloser()
+
+		mAddr, err := minerApi.ActorAddress(ctx)
+		if err != nil {
+			return err
+		}
+
+		audit, err := apiwrapper.NewLotusAPIWrapper(api, minerApi).StorageAudit(ctx, mAddr)
+		if err != nil {
+			return err
+		}
+
+		switch cctx.String("output") {
+		case "table":
+			return printAudit(os.Stdout, audit)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(audit)
+		default:
+			return xerrors.Errorf("unknown output format: %s", cctx.String("output"))
+		}
+	},
+}
+
+func printAudit(out io.Writer, a *apitypes.StorageAudit) error {
+	fmt.Fprintf(out, "Miner %s, %d live sectors, %d issues\n", a.MinerID, a.LiveSectors, a.Issues())
+
+	if len(a.FailedPaths) > 0 {
+		fmt.Fprintf(out, "\nStorage paths failing stat (%d):\n", len(a.FailedPaths))
+		tw := tabwriter.NewWriter(out, 2, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tLOCAL\tURLS\tERROR")
+		for _, si := range a.FailedPaths {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", si.ID, si.Local, strings.Join(si.URLs, ","), si.StatError)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(a.MissingSealed) > 0 {
+		fmt.Fprintf(out, "\nLive sectors without a sealed copy (%d): %s\n", len(a.MissingSealed), joinNums(a.MissingSealed))
+	}
+	if len(a.MissingCache) > 0 {
+		fmt.Fprintf(out, "\nLive sectors without a cache copy (%d): %s\n", len(a.MissingCache), joinNums(a.MissingCache))
+	}
+	for _, section := range []struct {
+		title string
+		decls []*apitypes.SectorFileDecls
+	}{
+		{"Duplicate sector files", a.Duplicates},
+		{"Orphan sector files", a.Orphans},
+	} {
+		if len(section.decls) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s (%d):\n", section.title, len(section.decls))
+		tw := tabwriter.NewWriter(out, 2, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SECTOR\tTYPE\tSTORAGE")
+		for _, d := range section.decls {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", d.SectorNum, d.FileType, strings.Join(d.StorageIDs, ","))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func joinNums(nums []uint64) string {
+	s := make([]string, len(nums))
+	for i, n := range nums {
+		s[i] = fmt.Sprint(n)
+	}
+	return strings.Join(s, ",")
+}
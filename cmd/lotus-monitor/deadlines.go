@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/guoxiaopeng875/lotus-adapter/apiwrapper"
+	lcli "github.com/guoxiaopeng875/lotus-adapter/cmd/cli"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+var deadlinesCmd = &cli.Command{
+	Name:  "deadlines",
+	Usage: "Print sectors and risk of every WindowPoSt deadline",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output format: table or json",
+			Value: "table",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := lcli.ReqContext(cctx)
+
+		api, closer, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		minerApi, mCloser, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer mCloser()
+
+		mAddr, err := minerApi.ActorAddress(ctx)
+		if err != nil {
+			return err
+		}
+
+		info, err := apiwrapper.NewLotusAPIWrapper(api, minerApi).MinerDeadlines(ctx, mAddr)
+		if err != nil {
+			return err
+		}
+
+		switch cctx.String("output") {
+		case "table":
+			return printDeadlines(os.Stdout, info)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(info)
+		default:
+			return xerrors.Errorf("unknown output format: %s", cctx.String("output"))
+		}
+	},
+}
+
+func printDeadlines(out io.Writer, info *apitypes.DeadlinesInfo) error {
+	fmt.Fprintf(out, "Miner %s, current epoch %d\n\n", info.MinerID, info.CurrentEpoch)
+	tw := tabwriter.NewWriter(out, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEADLINE\tOPEN\tCLOSE\tPARTITIONS\tLIVE\tACTIVE\tFAULTY\tRECOVERING\tUNREACHABLE\tRISK")
+	for _, dl := range info.Deadlines {
+		idx := fmt.Sprint(dl.Index)
+		if dl.Current {
+			idx += " (current)"
+		}
+		risk := ""
+		if dl.AtRisk {
+			risk = "AT RISK"
+		}
+		fmt.Fprintf(tw, "%s\t%d (%s)\t%d (%s)\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", idx,
+			dl.Open, dl.OpenTime.Format(time.Stamp), dl.Close, dl.CloseTime.Format(time.Stamp),
+			dl.Partitions, dl.Live, dl.Active, dl.Faulty, dl.Recovering, dl.Unreachable, risk)
+	}
+	return tw.Flush()
+}
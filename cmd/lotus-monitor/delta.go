@@ -0,0 +1,157 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+)
+
+// 每个矿工最近一次被确认的推送
+type pushState struct {
+	seq      uint64
+	acked    *apitypes.PushedMinerInfo
+	lastFull time.Time
+}
+
+// deltaOf 生成相对 base 的增量推送, base 为上一次被确认的完整数据
+func deltaOf(base, cur *apitypes.PushedMinerInfo, baseSeq uint64) *apitypes.PushedMinerInfo {
+	delta := *cur
+	delta.Mode = apitypes.PushModeDelta
+	delta.BaseSeq = baseSeq
+	delta.WorkerTaskState = nil
+	delta.StorageInfo = nil
+	delta.WorkerTaskDelta = diffWorkers(base.WorkerTaskState, cur.WorkerTaskState)
+	delta.StorageDelta = diffStorage(base.StorageInfo, cur.StorageInfo)
+	return &delta
+}
+
+func diffWorkers(old, cur []*apitypes.WorkerTaskState) *apitypes.WorkerTaskDelta {
+	oldByID := make(map[string]*apitypes.WorkerTaskState, len(old))
+	for _, w := range old {
+		oldByID[w.ID] = w
+	}
+
+	d := &apitypes.WorkerTaskDelta{}
+	for _, w := range cur {
+		ow, ok := oldByID[w.ID]
+		if !ok {
+			d.Added = append(d.Added, w)
+			continue
+		}
+		delete(oldByID, w.ID)
+		if change := diffWorker(ow, w); change != nil {
+			d.Changed = append(d.Changed, change)
+		}
+	}
+	for _, w := range old {
+		if _, ok := oldByID[w.ID]; ok {
+			d.Removed = append(d.Removed, w.ID)
+		}
+	}
+
+	if len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 {
+		return nil
+	}
+	return d
+}
+
+type jobKey struct {
+	task   string
+	sector uint64
+}
+
+func diffWorker(old, cur *apitypes.WorkerTaskState) *apitypes.WorkerTaskChange {
+	oldJobs := make(map[jobKey]*apitypes.SectorState, len(old.SectorStates))
+	for _, j := range old.SectorStates {
+		oldJobs[jobKey{j.Task, j.SectorNum}] = j
+	}
+
+	c := &apitypes.WorkerTaskChange{
+		ID:       cur.ID,
+		Hostname: cur.Hostname,
+		Enable:   cur.Enable,
+	}
+	for _, j := range cur.SectorStates {
+		k := jobKey{j.Task, j.SectorNum}
+		oj, ok := oldJobs[k]
+		if !ok {
+			c.AddedJobs = append(c.AddedJobs, j)
+			continue
+		}
+		delete(oldJobs, k)
+		if !sameJob(oj, j) {
+			c.ChangedJobs = append(c.ChangedJobs, j)
+		}
+	}
+	for _, j := range old.SectorStates {
+		if _, ok := oldJobs[jobKey{j.Task, j.SectorNum}]; ok {
+			c.RemovedJobs = append(c.RemovedJobs, j)
+		}
+	}
+
+	if old.Hostname == cur.Hostname && old.Enable == cur.Enable &&
+		len(c.AddedJobs) == 0 && len(c.RemovedJobs) == 0 && len(c.ChangedJobs) == 0 {
+		return nil
+	}
+	return c
+}
+
+// sameJob 比较任务的字段, Start 按时间比较. TaskTime 每次采集都会重新计算, 不参与比较, 接收方可以从 Start 推算
+func sameJob(a, b *apitypes.SectorState) bool {
+	if !a.Start.Equal(b.Start) {
+		return false
+	}
+	ca, cb := *a, *b
+	ca.Start, cb.Start = time.Time{}, time.Time{}
+	ca.TaskTime, cb.TaskTime = 0, 0
+	return ca == cb
+}
+
+// 剩余天数的变化小于该值时不算变化
+const daysUntilFullTolerance = 1.0
+
+// storageChanged 每次推送都会重新计算的预测字段不参与比较, 只有剩余天数有明显变化时才算变化
+func storageChanged(old, cur *apitypes.StorageInfo) bool {
+	o, c := *old, *cur
+	o.UsageRate, c.UsageRate = 0, 0
+	o.DaysUntilFull, c.DaysUntilFull = nil, nil
+	if !reflect.DeepEqual(&o, &c) {
+		return true
+	}
+	if (old.DaysUntilFull == nil) != (cur.DaysUntilFull == nil) {
+		return true
+	}
+	return old.DaysUntilFull != nil && math.Abs(*old.DaysUntilFull-*cur.DaysUntilFull) >= daysUntilFullTolerance
+}
+
+func diffStorage(old, cur []*apitypes.StorageInfo) *apitypes.StorageDelta {
+	oldByID := make(map[string]*apitypes.StorageInfo, len(old))
+	for _, si := range old {
+		oldByID[si.ID] = si
+	}
+
+	d := &apitypes.StorageDelta{}
+	for _, si := range cur {
+		osi, ok := oldByID[si.ID]
+		if !ok {
+			d.Added = append(d.Added, si)
+			continue
+		}
+		delete(oldByID, si.ID)
+		if storageChanged(osi, si) {
+			d.Changed = append(d.Changed, si)
+		}
+	}
+	for _, si := range old {
+		if _, ok := oldByID[si.ID]; ok {
+			d.Removed = append(d.Removed, si.ID)
+		}
+	}
+
+	if len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 {
+		return nil
+	}
+	return d
+}
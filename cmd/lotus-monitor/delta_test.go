@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaOf(t *testing.T) {
+	start := time.Now()
+	base := &apitypes.PushedMinerInfo{
+		MinerID: "f01000",
+		WorkerTaskState: []*apitypes.WorkerTaskState{
+			{ID: "w1", Hostname: "h1", Enable: true, SectorStates: []*apitypes.SectorState{
+				{Task: "PC1", SectorNum: 1, Start: start, RunWait: 1},
+				{Task: "PC1", SectorNum: 2, Start: start},
+			}},
+			{ID: "w2", Hostname: "h2", Enable: true},
+			{ID: "w3", Hostname: "h3", Enable: true},
+		},
+		StorageInfo: []*apitypes.StorageInfo{
+			{ID: "s1", Available: 100},
+			{ID: "s2", Available: 100},
+		},
+	}
+	cur := &apitypes.PushedMinerInfo{
+		MinerID: "f01000",
+		Seq:     2,
+		WorkerTaskState: []*apitypes.WorkerTaskState{
+			{ID: "w1", Hostname: "h1", Enable: true, SectorStates: []*apitypes.SectorState{
+				{Task: "PC1", SectorNum: 1, Start: start},
+				{Task: "PC1", SectorNum: 3, Start: start},
+			}},
+			{ID: "w2", Hostname: "h2", Enable: true},
+			{ID: "w4", Hostname: "h4", Enable: true},
+		},
+		StorageInfo: []*apitypes.StorageInfo{
+			{ID: "s1", Available: 50},
+			{ID: "s3", Available: 100},
+		},
+	}
+
+	d := deltaOf(base, cur, 1)
+	require.Equal(t, apitypes.PushModeDelta, d.Mode)
+	require.Equal(t, uint64(1), d.BaseSeq)
+	require.Nil(t, d.WorkerTaskState)
+	require.Nil(t, d.StorageInfo)
+
+	wd := d.WorkerTaskDelta
+	require.NotNil(t, wd)
+	require.Len(t, wd.Added, 1)
+	require.Equal(t, "w4", wd.Added[0].ID)
+	require.Equal(t, []string{"w3"}, wd.Removed)
+	require.Len(t, wd.Changed, 1)
+	c := wd.Changed[0]
+	require.Equal(t, "w1", c.ID)
+	require.Len(t, c.AddedJobs, 1)
+	require.Equal(t, uint64(3), c.AddedJobs[0].SectorNum)
+	require.Len(t, c.RemovedJobs, 1)
+	require.Equal(t, uint64(2), c.RemovedJobs[0].SectorNum)
+	require.Len(t, c.ChangedJobs, 1)
+	require.Equal(t, 0, c.ChangedJobs[0].RunWait)
+
+	sd := d.StorageDelta
+	require.NotNil(t, sd)
+	require.Len(t, sd.Added, 1)
+	require.Equal(t, "s3", sd.Added[0].ID)
+	require.Equal(t, []string{"s2"}, sd.Removed)
+	require.Len(t, sd.Changed, 1)
+	require.Equal(t, int64(50), sd.Changed[0].Available)
+
+	// 没有变化时不携带增量
+	same := deltaOf(cur, cur, 2)
+	require.Nil(t, same.WorkerTaskDelta)
+	require.Nil(t, same.StorageDelta)
+
+	// 只有已运行时间变化时不推送
+	running := *cur.WorkerTaskState[0].SectorStates[0]
+	running.TaskTime += 60
+	next := *cur
+	next.WorkerTaskState = []*apitypes.WorkerTaskState{
+		{ID: "w1", Hostname: "h1", Enable: true, SectorStates: []*apitypes.SectorState{&running, cur.WorkerTaskState[0].SectorStates[1]}},
+		cur.WorkerTaskState[1], cur.WorkerTaskState[2],
+	}
+	require.Nil(t, deltaOf(cur, &next, 2).WorkerTaskDelta)
+
+	// 卡住标记等任务字段的变化也要推送
+	stuck := *cur.WorkerTaskState[0].SectorStates[0]
+	stuck.TaskTime, stuck.Baseline, stuck.Stuck = 7200, 3600, true
+	next.WorkerTaskState = []*apitypes.WorkerTaskState{
+		{ID: "w1", Hostname: "h1", Enable: true, SectorStates: []*apitypes.SectorState{&stuck, cur.WorkerTaskState[0].SectorStates[1]}},
+		cur.WorkerTaskState[1], cur.WorkerTaskState[2],
+	}
+	d = deltaOf(cur, &next, 2)
+	require.NotNil(t, d.WorkerTaskDelta)
+	require.Len(t, d.WorkerTaskDelta.Changed, 1)
+	require.Equal(t, []*apitypes.SectorState{&stuck}, d.WorkerTaskDelta.Changed[0].ChangedJobs)
+
+	// 重新计算的存储预测只有剩余天数明显变化时才推送
+	days := func(v float64) *float64 { return &v }
+	old := []*apitypes.StorageInfo{{ID: "s1", Available: 50, UsageRate: 100, DaysUntilFull: days(10)}}
+	require.Nil(t, diffStorage(old, []*apitypes.StorageInfo{{ID: "s1", Available: 50, UsageRate: 120, DaysUntilFull: days(10.5)}}))
+	require.NotNil(t, diffStorage(old, []*apitypes.StorageInfo{{ID: "s1", Available: 50, UsageRate: 200, DaysUntilFull: days(5)}}))
+	require.NotNil(t, diffStorage(old, []*apitypes.StorageInfo{{ID: "s1", Available: 50}}))
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+	"gopkg.in/resty.v1"
+)
+
+// 资产快照的保存间隔, 日报只需要每天开始和结束时的快照
+const assetsInterval = time.Hour
+
+type EarningsReport struct {
+	From time.Time        `json:"from"`
+	To   time.Time        `json:"to"`
+	Days []*DailyEarnings `json:"days"`
+}
+
+// DailyEarnings 一个矿工一天的收益, 余额变化按当天开始和结束时的资产快照计算
+type DailyEarnings struct {
+	MinerID string `json:"miner_id"`
+	// 日期, 按监控所在时区
+	Date string `json:"date"`
+	// 实际使用的两次快照的时间, 链上数据也按这个时间段统计
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// 时间段没有覆盖全天(当天还没结束或监控中断)
+	Partial bool `json:"partial"`
+
+	Blocks   int   `json:"blocks"`
+	WinCount int64 `json:"win_count"`
+	// 出块奖励(不含小费)
+	Rewards abi.TokenAmount `json:"rewards"`
+	// 锁仓释放: 新增的奖励锁仓减去锁仓余额的变化, 从锁仓中扣除的罚金也计入这里
+	VestingReleased abi.TokenAmount `json:"vesting_released"`
+	// 质押变化, 扇区到期或被终止时为负
+	PledgeAdded abi.TokenAmount `json:"pledge_added"`
+	// 控制地址发送消息燃烧的gas
+	GasBurned abi.TokenAmount `json:"gas_burned"`
+	// 罚金: 无法用奖励, 转入和提取解释的矿工余额减少
+	Penalties abi.TokenAmount `json:"penalties"`
+	Inflow    abi.TokenAmount `json:"inflow"`
+	Withdrawn abi.TokenAmount `json:"withdrawn"`
+	// 矿工账户余额变化
+	BalanceChange abi.TokenAmount `json:"balance_change"`
+}
+
+type assetSnapshot struct {
+	at    time.Time
+	asset *apitypes.ClusterAssetInfo
+}
+
+// buildEarningsReport 按 loc 时区把 [from, to] 切成自然日, 每天取当天开始后的第一个快照和下一天开始后的第一个快照
+// (当天还没结束时取当天最后一个快照), 两次快照之间的余额变化结合链上数据得出各项收益. 没有两个快照的日期不输出
+func buildEarningsReport(miner string, snaps []assetSnapshot, epochs []*apitypes.EpochEarnings, from, to time.Time, loc *time.Location) []*DailyEarnings {
+	var out []*DailyEarnings
+	y, m, d := from.In(loc).Date()
+	for ds := time.Date(y, m, d, 0, 0, 0, 0, loc); !ds.After(to); ds = ds.AddDate(0, 0, 1) {
+		de := ds.AddDate(0, 0, 1)
+		start, end := -1, -1
+		for i, s := range snaps {
+			if s.at.Before(ds) {
+				continue
+			}
+			if start < 0 {
+				if !s.at.Before(de) {
+					break
+				}
+				start = i
+			}
+			end = i
+			if !s.at.Before(de) {
+				break
+			}
+		}
+		if start < 0 || end <= start {
+			continue
+		}
+
+		s, e := snaps[start], snaps[end]
+		day := &DailyEarnings{
+			MinerID:   miner,
+			Date:      ds.Format("2006-01-02"),
+			From:      s.at,
+			To:        e.at,
+			Partial:   s.at.Sub(ds) > 2*assetsInterval || e.at.Before(de),
+			Rewards:   big.Zero(),
+			GasBurned: big.Zero(),
+			Inflow:    big.Zero(),
+			Withdrawn: big.Zero(),
+		}
+		locked := big.Zero()
+		for _, ee := range epochs {
+			at := time.Unix(ee.Timestamp, 0)
+			if at.Before(s.at) || !at.Before(e.at) {
+				continue
+			}
+			day.Blocks += ee.Blocks
+			day.WinCount += ee.WinCount
+			day.Rewards = big.Add(day.Rewards, ee.Reward)
+			locked = big.Add(locked, ee.RewardLocked)
+			day.GasBurned = big.Add(day.GasBurned, ee.GasBurned)
+			day.Inflow = big.Add(day.Inflow, ee.Inflow)
+			day.Withdrawn = big.Add(day.Withdrawn, ee.Withdrawn)
+		}
+
+		day.BalanceChange = big.Sub(e.asset.MinerBalance, s.asset.MinerBalance)
+		day.VestingReleased = big.Sub(locked, big.Sub(e.asset.VestingFunds, s.asset.VestingFunds))
+		day.PledgeAdded = big.Sub(e.asset.InitialPledgeRequirement, s.asset.InitialPledgeRequirement)
+		day.Penalties = big.Sub(big.Sub(big.Add(day.Rewards, day.Inflow), day.Withdrawn), day.BalanceChange)
+		out = append(out, day)
+	}
+	return out
+}
+
+// earningsReport 从历史记录中读取 [from, to] 内的资产快照和链上数据并生成日报
+func (p *Processor) earningsReport(miner string, from, to time.Time) (*EarningsReport, error) {
+	rep := &EarningsReport{From: from, To: to, Days: []*DailyEarnings{}}
+	for mAddr := range p.apis {
+		if miner != "" && miner != mAddr.String() {
+			continue
+		}
+		// 最后一天需要下一天开始后的快照
+		until := to.Add(24 * time.Hour)
+		var snaps []assetSnapshot
+		err := p.opts.History.Range(historyAssets, mAddr.String(), from, until, func(at time.Time, data []byte) error {
+			var cai apitypes.ClusterAssetInfo
+			if err := json.Unmarshal(data, &cai); err != nil {
+				return err
+			}
+			snaps = append(snaps, assetSnapshot{at: at, asset: &cai})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		var epochs []*apitypes.EpochEarnings
+		err = p.opts.History.Range(historyEarnings, mAddr.String(), from, until, func(at time.Time, data []byte) error {
+			var ee apitypes.EpochEarnings
+			if err := json.Unmarshal(data, &ee); err != nil {
+				return err
+			}
+			epochs = append(epochs, &ee)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		rep.Days = append(rep.Days, buildEarningsReport(mAddr.String(), snaps, epochs, from, to, time.Local)...)
+	}
+	return rep, nil
+}
+
+// /report/earnings?days=7&miner=<minerID>
+func (p *Processor) handleEarningsReport(w http.ResponseWriter, r *http.Request) {
+	days := 7
+	if s := r.URL.Query().Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("bad days: %s", s), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	now := time.Now()
+	y, m, d := now.Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, time.Local).AddDate(0, 0, 1-days)
+	rep, err := p.earningsReport(r.URL.Query().Get("miner"), from, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
+
+var reportEarningsCmd = &cli.Command{
+	Name:  "earnings",
+	Usage: "Daily block rewards, vesting released, pledge added, gas burned and penalties",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "days",
+			Usage: "number of days to report, including today",
+			Value: 7,
+		},
+		&cli.StringFlag{
+			Name:  "miner",
+			Usage: "only report this miner",
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output format: table, csv or json",
+			Value: "table",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		resp, err := resty.New().R().
+			SetQueryParam("days", strconv.Itoa(cctx.Int("days"))).
+			SetQueryParam("miner", cctx.String("miner")).
+			Get(cctx.String("monitor-api") + "/report/earnings")
+		if err != nil {
+			return xerrors.Errorf("requesting report: %w", err)
+		}
+		if resp.StatusCode() != http.StatusOK {
+			return xerrors.Errorf("requesting report: %d %s", resp.StatusCode(), string(resp.Body()))
+		}
+		var rep EarningsReport
+		if err := json.Unmarshal(resp.Body(), &rep); err != nil {
+			return xerrors.Errorf("decoding report: %w", err)
+		}
+
+		switch cctx.String("output") {
+		case "table":
+			return printEarningsTable(os.Stdout, &rep)
+		case "csv":
+			return printEarningsCSV(os.Stdout, &rep)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(&rep)
+		default:
+			return xerrors.Errorf("unknown output format: %s", cctx.String("output"))
+		}
+	},
+}
+
+func printEarningsTable(out io.Writer, rep *EarningsReport) error {
+	tw := tabwriter.NewWriter(out, 2, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "MINER\tDATE\tBLOCKS\tREWARDS\tVESTING RELEASED\tPLEDGE ADDED\tGAS BURNED\tPENALTIES\tBALANCE CHANGE\n")
+	for _, d := range rep.Days {
+		date := d.Date
+		if d.Partial {
+			date += "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", d.MinerID, date, d.Blocks,
+			types.FIL(d.Rewards), types.FIL(d.VestingReleased), types.FIL(d.PledgeAdded),
+			types.FIL(d.GasBurned), types.FIL(d.Penalties), types.FIL(d.BalanceChange))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "* partial day: not finished yet or monitoring was interrupted")
+	return nil
+}
+
+// printEarningsCSV 金额以FIL为单位
+func printEarningsCSV(out io.Writer, rep *EarningsReport) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"miner_id", "date", "from", "to", "partial", "blocks", "win_count", "rewards",
+		"vesting_released", "pledge_added", "gas_burned", "penalties", "inflow", "withdrawn", "balance_change"}); err != nil {
+		return err
+	}
+	for _, d := range rep.Days {
+		row := []string{d.MinerID, d.Date, d.From.Format(time.RFC3339), d.To.Format(time.RFC3339), strconv.FormatBool(d.Partial),
+			strconv.Itoa(d.Blocks), strconv.FormatInt(d.WinCount, 10)}
+		for _, v := range []abi.TokenAmount{d.Rewards, d.VestingReleased, d.PledgeAdded, d.GasBurned, d.Penalties, d.Inflow, d.Withdrawn, d.BalanceChange} {
+			row = append(row, types.FIL(v).Unitless())
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
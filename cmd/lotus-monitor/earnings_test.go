@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEarningsReport(t *testing.T) {
+	day := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	fil := func(n int64) abi.TokenAmount { return big.NewInt(n) }
+	asset := func(balance, vesting, pledge int64) *apitypes.ClusterAssetInfo {
+		return &apitypes.ClusterAssetInfo{MinerBalance: fil(balance), VestingFunds: fil(vesting), InitialPledgeRequirement: fil(pledge)}
+	}
+	snaps := []assetSnapshot{
+		{at: day.Add(30 * time.Minute), asset: asset(1000, 500, 300)},
+		{at: day.Add(12 * time.Hour), asset: asset(1050, 540, 330)},
+		{at: day.Add(24*time.Hour + 10*time.Minute), asset: asset(1090, 560, 360)},
+		{at: day.Add(30 * time.Hour), asset: asset(1100, 560, 360)},
+	}
+	epoch := func(at time.Duration, reward, locked, gas, inflow, withdrawn int64) *apitypes.EpochEarnings {
+		ee := &apitypes.EpochEarnings{Timestamp: day.Add(at).Unix(),
+			Reward: fil(reward), RewardLocked: fil(locked), GasBurned: fil(gas), Inflow: fil(inflow), Withdrawn: fil(withdrawn)}
+		if reward > 0 {
+			ee.Blocks, ee.WinCount = 1, 1
+		}
+		return ee
+	}
+	epochs := []*apitypes.EpochEarnings{
+		// 第一个快照之前, 不计入
+		epoch(10*time.Minute, 100, 75, 1, 0, 0),
+		epoch(time.Hour, 80, 60, 2, 0, 0),
+		epoch(2*time.Hour, 0, 0, 3, 50, 0),
+		epoch(20*time.Hour, 40, 30, 4, 0, 20),
+		epoch(25*time.Hour, 20, 15, 5, 0, 0),
+	}
+
+	days := buildEarningsReport("f01000", snaps, epochs, day, day.Add(30*time.Hour), time.UTC)
+	require.Len(t, days, 2)
+
+	d := days[0]
+	require.Equal(t, "2020-11-01", d.Date)
+	require.False(t, d.Partial)
+	require.Equal(t, snaps[2].at, d.To)
+	require.Equal(t, 2, d.Blocks)
+	require.Equal(t, fil(120), d.Rewards)
+	require.Equal(t, fil(9), d.GasBurned)
+	require.Equal(t, fil(90), d.BalanceChange)
+	// 新增锁仓90, 锁仓余额增加60
+	require.Equal(t, fil(30), d.VestingReleased)
+	require.Equal(t, fil(60), d.PledgeAdded)
+	// 120 + 50 - 20 - 90
+	require.Equal(t, fil(60), d.Penalties)
+
+	// 当天还没结束
+	d = days[1]
+	require.Equal(t, "2020-11-02", d.Date)
+	require.True(t, d.Partial)
+	require.Equal(t, fil(20), d.Rewards)
+	require.Equal(t, fil(15), d.VestingReleased)
+	require.Equal(t, fil(10), d.Penalties)
+}
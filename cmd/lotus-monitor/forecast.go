@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+)
+
+type storageSample struct {
+	at        time.Time
+	available int64
+}
+
+// capacityForecast 保存每个存储路径最近 window 内的可用空间, 用线性回归估算空间消耗速度
+type capacityForecast struct {
+	window  time.Duration
+	samples map[string][]storageSample
+}
+
+func newCapacityForecast(window time.Duration) *capacityForecast {
+	return &capacityForecast{window: window, samples: make(map[string][]storageSample)}
+}
+
+func (f *capacityForecast) add(id string, at time.Time, available int64) {
+	s := append(f.samples[id], storageSample{at: at, available: available})
+	cutoff := at.Add(-f.window)
+	for len(s) > 0 && s[0].at.Before(cutoff) {
+		s = s[1:]
+	}
+	f.samples[id] = s
+}
+
+// rate 返回每秒消耗的字节数, 样本覆盖的时间不足 window 的1/4时返回false
+func (f *capacityForecast) rate(id string) (float64, bool) {
+	s := f.samples[id]
+	if len(s) < 2 || s[len(s)-1].at.Sub(s[0].at) < f.window/4 {
+		return 0, false
+	}
+
+	// 最小二乘拟合 available = a + b*t
+	var sx, sy, sxx, sxy float64
+	n := float64(len(s))
+	for _, smp := range s {
+		x := smp.at.Sub(s[0].at).Seconds()
+		y := float64(smp.available)
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0, false
+	}
+	return -(n*sxy - sx*sy) / den, true
+}
+
+// apply 记录本次采集的可用空间并填上 UsageRate 和 DaysUntilFull
+func (f *capacityForecast) apply(sis []*apitypes.StorageInfo, now time.Time) {
+	seen := make(map[string]struct{}, len(sis))
+	for _, si := range sis {
+		// 获取容量失败的路径没有可用数据
+		if si.Capacity == 0 {
+			continue
+		}
+		seen[si.ID] = struct{}{}
+		f.add(si.ID, now, si.Available)
+
+		rate, ok := f.rate(si.ID)
+		if !ok {
+			continue
+		}
+		perDay := rate * 24 * 3600
+		si.UsageRate = int64(perDay)
+		if perDay > 0 {
+			days := math.Round(float64(si.Available)/perDay*10) / 10
+			si.DaysUntilFull = &days
+		}
+	}
+	for id := range f.samples {
+		if _, ok := seen[id]; !ok {
+			delete(f.samples, id)
+		}
+	}
+}
+
+// forecastStorage 估算每个存储路径的剩余可用天数, 首次调用时从历史记录加载最近的样本
+func (p *Processor) forecastStorage(mAddr address.Address, mi *apitypes.PushedMinerInfo, now time.Time) {
+	if p.opts.ForecastWindow == 0 {
+		return
+	}
+	f, ok := p.forecasts[mAddr]
+	if !ok {
+		f = newCapacityForecast(p.opts.ForecastWindow)
+		p.forecasts[mAddr] = f
+		if p.opts.History != nil {
+			err := p.opts.History.Range(historyStorage, mAddr.String(), now.Add(-f.window), now, func(at time.Time, data []byte) error {
+				var rec map[string]int64
+				if err := json.Unmarshal(data, &rec); err != nil {
+					return err
+				}
+				for id, available := range rec {
+					f.add(id, at, available)
+				}
+				return nil
+			})
+			if err != nil {
+				log.Errorf("loading storage history failed, %s", err)
+			}
+		}
+	}
+	f.apply(mi.StorageInfo, now)
+}
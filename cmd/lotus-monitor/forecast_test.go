@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapacityForecast(t *testing.T) {
+	const gib = int64(1 << 30)
+	f := newCapacityForecast(24 * time.Hour)
+	t0 := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	// 每小时写入 1GiB
+	var si *apitypes.StorageInfo
+	for h := 0; h <= 12; h++ {
+		si = &apitypes.StorageInfo{ID: "s1", Capacity: 1000 * gib, Available: (500 - int64(h)) * gib, CanStore: true}
+		f.apply([]*apitypes.StorageInfo{si}, t0.Add(time.Duration(h)*time.Hour))
+		if h < 6 {
+			require.Nil(t, si.DaysUntilFull, "not enough samples at hour %d", h)
+		}
+	}
+	require.Equal(t, 24*gib, si.UsageRate)
+	require.NotNil(t, si.DaysUntilFull)
+	require.Equal(t, 20.3, *si.DaysUntilFull)
+
+	// 空间在释放时不估算剩余天数
+	freed := &apitypes.StorageInfo{ID: "s1", Capacity: 1000 * gib, Available: 900 * gib}
+	f.apply([]*apitypes.StorageInfo{freed}, t0.Add(13*time.Hour))
+	for h := 14; h < 40; h++ {
+		freed = &apitypes.StorageInfo{ID: "s1", Capacity: 1000 * gib, Available: 900 * gib}
+		f.apply([]*apitypes.StorageInfo{freed}, t0.Add(time.Duration(h)*time.Hour))
+	}
+	require.Nil(t, freed.DaysUntilFull)
+	require.Zero(t, freed.UsageRate)
+
+	// 消失的路径不再保留样本
+	f.apply(nil, t0.Add(41*time.Hour))
+	require.Empty(t, f.samples)
+
+	cfg := &AlertConfig{Rules: []*AlertRule{{Type: RuleStorageFullWithin, Threshold: "30"}}}
+	require.NoError(t, cfg.init())
+	out := NewAlerter(cfg, nil, "").Evaluate([]*apitypes.PushedMinerInfo{
+		{MinerID: "f01000", StorageInfo: []*apitypes.StorageInfo{si}},
+	}, t0)
+	require.Len(t, out, 1)
+	require.Equal(t, "s1", out[0].Subject)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/guoxiaopeng875/lotus-adapter/apiwrapper"
+	"golang.org/x/xerrors"
+)
+
+type minerStatus struct {
+	MinerID string `json:"miner_id"`
+	// 最近一次成功采集的时间
+	LastCollect *time.Time `json:"last_collect,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+
+	snapshot *apitypes.PushedMinerInfo
+}
+
+type healthStatus struct {
+	Ready   bool      `json:"ready"`
+	Started time.Time `json:"started"`
+	// 最近一次成功推送的时间
+	LastPush      *time.Time     `json:"last_push,omitempty"`
+	LastPushError string         `json:"last_push_error,omitempty"`
+	Miners        []*minerStatus `json:"miners"`
+}
+
+// healthTracker 记录每个矿工的采集和推送结果, 供 /healthz /readyz /snapshot 使用
+type healthTracker struct {
+	lk            sync.Mutex
+	started       time.Time
+	lastPush      *time.Time
+	lastPushError string
+	miners        map[address.Address]*minerStatus
+}
+
+func newHealthTracker(apis map[address.Address]*apiwrapper.LotusAPIWrapper) *healthTracker {
+	h := &healthTracker{
+		started: time.Now(),
+		miners:  make(map[address.Address]*minerStatus, len(apis)),
+	}
+	for mAddr := range apis {
+		h.miners[mAddr] = &minerStatus{MinerID: mAddr.String()}
+	}
+	return h
+}
+
+// collected 记录采集结果, 快照保存的是副本, 推送流程之后还会修改 mi, 而 /snapshot 在其他goroutine中读取
+func (h *healthTracker) collected(mAddr address.Address, mi *apitypes.PushedMinerInfo, err error, now time.Time) {
+	var snap *apitypes.PushedMinerInfo
+	if err == nil {
+		if snap, err = cloneMinerInfo(mi); err != nil {
+			err = xerrors.Errorf("copying snapshot: %w", err)
+		}
+	}
+
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	ms, ok := h.miners[mAddr]
+	if !ok {
+		ms = &minerStatus{MinerID: mAddr.String()}
+		h.miners[mAddr] = ms
+	}
+	if err != nil {
+		ms.LastError = err.Error()
+		ms.LastErrorAt = &now
+		return
+	}
+	ms.LastCollect = &now
+	ms.LastError = ""
+	ms.snapshot = snap
+}
+
+func cloneMinerInfo(mi *apitypes.PushedMinerInfo) (*apitypes.PushedMinerInfo, error) {
+	b, err := json.Marshal(mi)
+	if err != nil {
+		return nil, err
+	}
+	var cp apitypes.PushedMinerInfo
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (h *healthTracker) pushed(err error, now time.Time) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	if err != nil {
+		h.lastPushError = err.Error()
+		return
+	}
+	h.lastPush = &now
+	h.lastPushError = ""
+}
+
+// status 汇总当前状态, 所有矿工都在 staleAfter 内采集成功且推送成功时为 ready
+func (h *healthTracker) status(staleAfter time.Duration, now time.Time) *healthStatus {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	st := &healthStatus{
+		Ready:         h.lastPush != nil && now.Sub(*h.lastPush) <= staleAfter,
+		Started:       h.started,
+		LastPush:      h.lastPush,
+		LastPushError: h.lastPushError,
+	}
+	for _, ms := range h.miners {
+		cp := *ms
+		st.Miners = append(st.Miners, &cp)
+		if ms.LastCollect == nil || now.Sub(*ms.LastCollect) > staleAfter {
+			st.Ready = false
+		}
+	}
+	sort.Slice(st.Miners, func(i, j int) bool {
+		return st.Miners[i].MinerID < st.Miners[j].MinerID
+	})
+	return st
+}
+
+func (h *healthTracker) snapshot() []*apitypes.PushedMinerInfo {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	var out []*apitypes.PushedMinerInfo
+	for _, ms := range h.miners {
+		if ms.snapshot != nil {
+			out = append(out, ms.snapshot)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].MinerID < out[j].MinerID
+	})
+	return out
+}
+
+// Handler 提供 /healthz, /readyz, /snapshot, /report/workers 和 /report/earnings,
+// 超过 staleAfter 没有成功采集或推送时 /readyz 返回503
+func (p *Processor) Handler(staleAfter time.Duration) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, p.health.status(staleAfter, time.Now()))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		st := p.health.status(staleAfter, time.Now())
+		code := http.StatusOK
+		if !st.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, st)
+	})
+	mux.HandleFunc("/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		snap := p.health.snapshot()
+		if len(snap) == 0 {
+			http.Error(w, "no snapshot collected yet", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, http.StatusOK, snap)
+	})
+	if p.opts.History != nil {
+		mux.HandleFunc("/report/workers", p.handleWorkersReport)
+		mux.HandleFunc("/report/earnings", p.handleEarningsReport)
+	}
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warnf("writing response: %s", err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthSnapshotCopy(t *testing.T) {
+	mAddr, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	h := newHealthTracker(nil)
+
+	mi := &apitypes.PushedMinerInfo{
+		MinerID:     mAddr.String(),
+		StorageInfo: []*apitypes.StorageInfo{{ID: "s1", Available: 100}},
+	}
+	h.collected(mAddr, mi, nil, time.Now())
+
+	// 推送流程之后的修改不影响已保存的快照
+	mi.Seq = 2
+	mi.StorageInfo[0].UsageRate = 10
+	snap := h.snapshot()
+	require.Len(t, snap, 1)
+	require.Zero(t, snap[0].Seq)
+	require.Zero(t, snap[0].StorageInfo[0].UsageRate)
+	require.Equal(t, int64(100), snap[0].StorageInfo[0].Available)
+}
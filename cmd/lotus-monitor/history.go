@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+)
+
+// 历史记录的种类
+const (
+	// worker任务快照
+	historyWorkers = "workers"
+	// 每个存储路径的可用空间
+	historyStorage = "storage"
+	// 资产快照 apitypes.ClusterAssetInfo
+	historyAssets = "assets"
+	// 链上收益数据 apitypes.EpochEarnings, 时间为高度的时间戳
+	historyEarnings = "earnings"
+)
+
+// History 按时间保存每个矿工的采集数据, key: /history/<kind>/<miner>/<UTC日期>/<unix nano>.
+// 记录按天分组, 查询时间范围时只读取相关日期的记录
+type History struct {
+	ds datastore.Batching
+}
+
+const historyDayLayout = "20060102"
+
+func NewHistory(ds datastore.Batching) *History {
+	return &History{ds: ds}
+}
+
+// Record 保存一条记录, v 编码为JSON
+func (h *History) Record(kind, miner string, at time.Time, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return xerrors.Errorf("encoding %s history: %w", kind, err)
+	}
+	k := historyKey(kind, miner).ChildString(at.UTC().Format(historyDayLayout)).ChildString(fmt.Sprintf("%020d", at.UnixNano()))
+	if err := h.ds.Put(k, b); err != nil {
+		return xerrors.Errorf("saving %s history: %w", kind, err)
+	}
+	return nil
+}
+
+// Range 按时间顺序遍历 [from, to] 内的记录
+func (h *History) Range(kind, miner string, from, to time.Time, cb func(at time.Time, data []byte) error) error {
+	// 时间范围限制在已有记录内, 避免逐天查询没有记录的日期
+	first, _, err := h.edge(kind, miner, query.OrderByKey{})
+	if err != nil || first.IsZero() {
+		return err
+	}
+	last, _, err := h.edge(kind, miner, query.OrderByKeyDescending{})
+	if err != nil {
+		return err
+	}
+	if from.Before(first) {
+		from = first
+	}
+	if to.After(last) {
+		to = last
+	}
+
+	u := from.UTC()
+	for day := time.Date(u.Year(), u.Month(), u.Day(), 0, 0, 0, 0, time.UTC); !day.After(to); day = day.AddDate(0, 0, 1) {
+		done := false
+		err := h.each(historyKey(kind, miner).ChildString(day.Format(historyDayLayout)), kind, func(at time.Time, key string, data []byte) (bool, error) {
+			if at.Before(from) {
+				return true, nil
+			}
+			if at.After(to) {
+				done = true
+				return false, nil
+			}
+			return true, cb(at, data)
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+	return nil
+}
+
+// Last 返回最新的一条记录, 没有记录时 data 为nil
+func (h *History) Last(kind, miner string) (time.Time, []byte, error) {
+	return h.edge(kind, miner, query.OrderByKeyDescending{})
+}
+
+// edge 返回按 order 排序的第一条记录
+func (h *History) edge(kind, miner string, order query.Order) (time.Time, []byte, error) {
+	res, err := h.ds.Query(query.Query{
+		Prefix: historyKey(kind, miner).String(),
+		Orders: []query.Order{order},
+		Limit:  1,
+	})
+	if err != nil {
+		return time.Time{}, nil, xerrors.Errorf("querying %s history: %w", kind, err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return time.Time{}, nil, xerrors.Errorf("reading %s history: %w", kind, r.Error)
+		}
+		nano, err := strconv.ParseInt(datastore.RawKey(r.Key).BaseNamespace(), 10, 64)
+		if err != nil {
+			return time.Time{}, nil, xerrors.Errorf("bad history key %s: %w", r.Key, err)
+		}
+		return time.Unix(0, nano), r.Value, nil
+	}
+	return time.Time{}, nil, nil
+}
+
+// Prune 删除早于 before 的记录
+func (h *History) Prune(kind, miner string, before time.Time) (int, error) {
+	var keys []datastore.Key
+	err := h.each(historyKey(kind, miner), kind, func(at time.Time, key string, _ []byte) (bool, error) {
+		if !at.Before(before) {
+			return false, nil
+		}
+		keys = append(keys, datastore.NewKey(key))
+		return true, nil
+	})
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	b, err := h.ds.Batch()
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	if err := b.Commit(); err != nil {
+		return 0, xerrors.Errorf("pruning %s history: %w", kind, err)
+	}
+	return len(keys), nil
+}
+
+// each 按key(即时间)顺序遍历 prefix 下的记录, cb 返回false时停止
+func (h *History) each(prefix datastore.Key, kind string, cb func(at time.Time, key string, data []byte) (bool, error)) error {
+	res, err := h.ds.Query(query.Query{
+		Prefix: prefix.String(),
+		Orders: []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return xerrors.Errorf("querying %s history: %w", kind, err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return xerrors.Errorf("reading %s history: %w", kind, r.Error)
+		}
+		nano, err := strconv.ParseInt(datastore.RawKey(r.Key).BaseNamespace(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("bad history key %s: %w", r.Key, err)
+		}
+		more, err := cb(time.Unix(0, nano), r.Key, r.Value)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+func historyKey(kind, miner string) datastore.Key {
+	return datastore.NewKey("/history").ChildString(kind).ChildString(miner)
+}
@@ -4,15 +4,25 @@ import (
 	"context"
 	"fmt"
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/lib/lotuslog"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
 	"github.com/guoxiaopeng875/lotus-adapter/apiwrapper"
 	lcli "github.com/guoxiaopeng875/lotus-adapter/cmd/cli"
+	"github.com/guoxiaopeng875/lotus-adapter/tracker"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	leveldb "github.com/ipfs/go-ds-leveldb"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/mitchellh/go-homedir"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
 	"gopkg.in/resty.v1"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -23,6 +33,10 @@ func main() {
 
 	local := []*cli.Command{
 		runCmd,
+		reportCmd,
+		auditCmd,
+		deadlinesCmd,
+		provingCmd,
 	}
 
 	app := &cli.App{
@@ -36,6 +50,12 @@ func main() {
 				EnvVars: []string{"LOTUS_PATH"},
 				Value:   "~/.lotus", // TODO: Consider XDG_DATA_HOME
 			},
+			&cli.StringFlag{
+				Name:    "monitor-repo",
+				EnvVars: []string{"LOTUS_MONITOR_PATH"},
+				Value:   "~/.lotusmonitor",
+				Usage:   "Specify the directory lotus-monitor keeps its history in",
+			},
 			&cli.StringFlag{
 				Name:    "miner-repo",
 				EnvVars: []string{"LOTUS_MINER_PATH", "LOTUS_STORAGE_PATH"},
@@ -71,6 +91,71 @@ var runCmd = &cli.Command{
 			Usage: "set monitor interval",
 			Value: time.Minute,
 		},
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "address the /healthz, /readyz, /snapshot and /report endpoints listen on",
+			Value: ":8875",
+		},
+		&cli.DurationFlag{
+			Name:  "stale-after",
+			Usage: "report not ready when no successful collection or push happened for this long (default 3x interval)",
+		},
+		&cli.StringFlag{
+			Name:  "sector-decls",
+			Usage: "how to report per-sector storage declarations: full, summary or none",
+			Value: apitypes.DeclModeFull,
+		},
+		&cli.BoolFlag{
+			Name:  "gzip",
+			Usage: "gzip push request bodies",
+		},
+		&cli.BoolFlag{
+			Name:  "delta",
+			Usage: "push only changes since the last acknowledged snapshot",
+		},
+		&cli.DurationFlag{
+			Name:  "full-interval",
+			Usage: "in delta mode, push a full snapshot at least this often",
+			Value: time.Hour,
+		},
+		&cli.StringFlag{
+			Name:  "alert-rules",
+			Usage: "path to an alert rules file (toml), alerts are disabled if empty",
+		},
+		&cli.StringFlag{
+			Name:  "alert-webhook",
+			Usage: "url alerts are posted to",
+		},
+		&cli.DurationFlag{
+			Name:  "history-retention",
+			Usage: "how long worker snapshots and storage usage are kept",
+			Value: 7 * 24 * time.Hour,
+		},
+		&cli.DurationFlag{
+			Name:  "forecast-window",
+			Usage: "estimate days until storage paths are full from usage in this window, 0 disables",
+			Value: 24 * time.Hour,
+		},
+		&cli.DurationFlag{
+			Name:  "runway-window",
+			Usage: "estimate how long control address balances last from on-chain spend in this window, 0 disables",
+			Value: 24 * time.Hour,
+		},
+		&cli.StringFlag{
+			Name:  "runway-safe-balance",
+			Usage: "balance (FIL) below which an address is considered out of runway",
+			Value: "1",
+		},
+		&cli.BoolFlag{
+			Name:  "earnings",
+			Usage: "record asset snapshots and on-chain earnings for the daily earnings report",
+			Value: true,
+		},
+		&cli.DurationFlag{
+			Name:  "earnings-retention",
+			Usage: "how long to keep asset snapshots and on-chain earnings, 0 keeps forever",
+			Value: 90 * 24 * time.Hour,
+		},
 		&cli.StringFlag{
 			Name:    "log-level",
 			EnvVars: []string{"GOLOG_LOG_LEVEL"},
@@ -79,15 +164,17 @@ var runCmd = &cli.Command{
 	},
 	Action: func(cctx *cli.Context) error {
 		log.Info("Starting lotus monitor")
-		go func() {
-			http.ListenAndServe(":8875", nil) //nolint:errcheck
-		}()
-
 		logLvl := cctx.String("log-level")
 		if err := logging.SetLogLevel("*", logLvl); err != nil {
 			return err
 		}
 
+		switch cctx.String("sector-decls") {
+		case apitypes.DeclModeFull, apitypes.DeclModeSummary, apitypes.DeclModeNone:
+		default:
+			return xerrors.Errorf("unknown sector decl mode: %s", cctx.String("sector-decls"))
+		}
+
 		ctx := lcli.ReqContext(cctx)
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
@@ -104,16 +191,75 @@ var runCmd = &cli.Command{
 		}
 		defer mCloser()
 
+		var alerter *Alerter
+		if path := cctx.String("alert-rules"); path != "" {
+			if !cctx.IsSet("alert-webhook") {
+				return xerrors.New("--alert-webhook is required with --alert-rules")
+			}
+			cfg, err := LoadAlertConfig(path)
+			if err != nil {
+				return err
+			}
+			alerter = NewAlerter(cfg, resty.New(), cctx.String("alert-webhook"))
+		}
+
 		mAddr, err := minerApi.ActorAddress(ctx)
 		if err != nil {
 			return err
 		}
+
+		mds, err := openMonitorDatastore(cctx)
+		if err != nil {
+			return err
+		}
+		defer mds.Close() //nolint:errcheck
+
+		tk, err := tracker.New(namespace.Wrap(mds, datastore.NewKey("/tracker").ChildString(mAddr.String())), tracker.DefaultOptions())
+		if err != nil {
+			return err
+		}
+		wrapper := apiwrapper.NewLotusAPIWrapper(api, minerApi)
+		wrapper.SetTracker(tk)
+		safeBalance, err := types.ParseFIL(cctx.String("runway-safe-balance"))
+		if err != nil {
+			return xerrors.Errorf("parsing runway-safe-balance: %w", err)
+		}
+		wrapper.SetRunwayOptions(apiwrapper.RunwayOptions{
+			Window:      cctx.Duration("runway-window"),
+			SafeBalance: abi.TokenAmount(safeBalance),
+		})
+
 		processor := NewProcessor(map[address.Address]*apiwrapper.LotusAPIWrapper{
-			mAddr: apiwrapper.NewLotusAPIWrapper(api, minerApi),
+			mAddr: wrapper,
 		}, resty.New(), cctx.String("proxy"), map[string]string{
 			"name":  "fxinggong",
 			"token": cctx.String("proxy-token"),
+		}, PushOptions{
+			DeclMode:          cctx.String("sector-decls"),
+			Gzip:              cctx.Bool("gzip"),
+			Delta:             cctx.Bool("delta"),
+			FullInterval:      cctx.Duration("full-interval"),
+			Alerter:           alerter,
+			History:           NewHistory(mds),
+			Retention:         cctx.Duration("history-retention"),
+			ForecastWindow:    cctx.Duration("forecast-window"),
+			Runway:            cctx.Duration("runway-window") > 0,
+			Earnings:          cctx.Bool("earnings"),
+			EarningsRetention: cctx.Duration("earnings-retention"),
 		})
+		staleAfter := cctx.Duration("stale-after")
+		if staleAfter == 0 {
+			staleAfter = 3 * cctx.Duration("interval")
+		}
+		go func() {
+			if err := http.ListenAndServe(cctx.String("listen"), processor.Handler(staleAfter)); err != nil {
+				log.Errorf("serving health endpoints: %s", err)
+			}
+		}()
+
+		go processor.RunRunway(ctx, cctx.Duration("interval"))
+		go processor.RunEarnings(ctx, cctx.Duration("interval"))
+
 		if err := processor.PushAll(); err != nil {
 			log.Errorf("push lotus miner info failed, %w", err)
 			return err
@@ -134,3 +280,18 @@ var runCmd = &cli.Command{
 
 	},
 }
+
+func openMonitorDatastore(cctx *cli.Context) (*leveldb.Datastore, error) {
+	p, err := homedir.Expand(cctx.String("monitor-repo"))
+	if err != nil {
+		return nil, xerrors.Errorf("could not expand home dir: %w", err)
+	}
+	if err := os.MkdirAll(p, 0755); err != nil {
+		return nil, err
+	}
+	ds, err := leveldb.NewDatastore(filepath.Join(p, "datastore"), nil)
+	if err != nil {
+		return nil, xerrors.Errorf("opening monitor datastore: %w", err)
+	}
+	return ds, nil
+}
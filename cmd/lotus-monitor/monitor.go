@@ -1,50 +1,279 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
 	"github.com/guoxiaopeng875/lotus-adapter/apiwrapper"
+	"golang.org/x/xerrors"
 	"gopkg.in/resty.v1"
 	"net/http"
+	"sync"
 	"time"
 )
 
+type PushOptions struct {
+	// 扇区声明的上报方式, 见 apitypes.DeclModeFull 等
+	DeclMode string
+	// 是否gzip压缩请求体
+	Gzip bool
+	// 是否只推送相对上一次确认快照的变化
+	Delta bool
+	// delta 模式下推送完整快照的间隔, 用于接收方重新同步
+	FullInterval time.Duration
+	// 为空时不计算告警
+	Alerter *Alerter
+	// 为空时不保存历史数据
+	History *History
+	// 历史数据保留时长
+	Retention time.Duration
+	// 估算存储路径剩余可用天数时使用的时间窗口, 为0时不估算
+	ForecastWindow time.Duration
+	// 是否估算控制地址余额可维持的天数, 由 RunRunway 在后台计算
+	Runway bool
+	// 是否保存资产快照和链上收益数据用于收益日报, 需要 History. 链上收益由 RunEarnings 在后台扫描
+	Earnings bool
+	// 资产快照和收益数据的保留时长
+	EarningsRetention time.Duration
+}
+
+// 接收方要求重新推送完整快照
+var errResync = xerrors.New("receiver requested a full snapshot")
+
 type Processor struct {
 	// minerID: lotusAPI
 	apis         map[address.Address]*apiwrapper.LotusAPIWrapper
 	cli          *resty.Client
 	proxyUrl     string
 	proxyHeaders map[string]string
+	opts         PushOptions
+	states       map[address.Address]*pushState
+	health       *healthTracker
+	forecasts    map[address.Address]*capacityForecast
+	// 上次保存资产快照的时间
+	assetsAt map[address.Address]time.Time
+	// 下次扫描链上收益数据的起始高度, 只在 RunEarnings 中使用
+	earningsFrom map[address.Address]abi.ChainEpoch
+	// 最近一次估算的余额可维持天数, 推送时附带
+	runwayLk sync.Mutex
+	runways  map[address.Address]*apitypes.RunwayInfo
 }
 
-func NewProcessor(apis map[address.Address]*apiwrapper.LotusAPIWrapper, cli *resty.Client, proxyUrl string, headers map[string]string) *Processor {
-	return &Processor{apis: apis, cli: cli, proxyUrl: proxyUrl, proxyHeaders: headers}
+func NewProcessor(apis map[address.Address]*apiwrapper.LotusAPIWrapper, cli *resty.Client, proxyUrl string, headers map[string]string, opts PushOptions) *Processor {
+	return &Processor{apis: apis, cli: cli, proxyUrl: proxyUrl, proxyHeaders: headers, opts: opts,
+		states:       make(map[address.Address]*pushState),
+		health:       newHealthTracker(apis),
+		forecasts:    make(map[address.Address]*capacityForecast),
+		assetsAt:     make(map[address.Address]time.Time),
+		earningsFrom: make(map[address.Address]abi.ChainEpoch),
+		runways:      make(map[address.Address]*apitypes.RunwayInfo),
+	}
 }
 
 func (p *Processor) PushAll() error {
+	now := time.Now()
+	current := make(map[address.Address]*apitypes.PushedMinerInfo, len(p.apis))
+	payloads := make(map[address.Address]*apitypes.PushedMinerInfo, len(p.apis))
 	var mis []*apitypes.PushedMinerInfo
 	for mAddr, apiWrapper := range p.apis {
 		mi, err := p.getPushedMinerInfo(mAddr, apiWrapper)
 		if err != nil {
+			p.health.collected(mAddr, nil, err, time.Now())
 			return err
 		}
-		mis = append(mis, mi)
+		p.forecastStorage(mAddr, mi, now)
+		p.record(mAddr, mi, now)
+		p.recordAssets(mAddr, mi, now)
+		current[mAddr] = mi
+		payloads[mAddr] = p.payloadFor(mAddr, mi, now)
+		// 所有修改完成后再保存快照
+		p.health.collected(mAddr, mi, nil, time.Now())
+		mis = append(mis, payloads[mAddr])
 	}
 	if len(mis) == 0 {
 		return nil
 	}
-	return p.do(mis)
+	if p.opts.Alerter != nil {
+		full := make([]*apitypes.PushedMinerInfo, 0, len(current))
+		for _, mi := range current {
+			full = append(full, mi)
+		}
+		if err := p.opts.Alerter.Process(full, now); err != nil {
+			log.Errorf("process alerts failed, %s", err)
+		}
+	}
+	err := p.do(mis)
+	p.health.pushed(err, time.Now())
+	if err != nil {
+		if xerrors.Is(err, errResync) {
+			log.Warn("receiver requested resync, next push will be a full snapshot")
+			p.states = make(map[address.Address]*pushState)
+		}
+		return err
+	}
+
+	// 推送成功, 记录本次快照作为下次增量的基准
+	for mAddr, mi := range current {
+		st, ok := p.states[mAddr]
+		if !ok {
+			st = &pushState{}
+			p.states[mAddr] = st
+		}
+		st.seq = mi.Seq
+		st.acked = mi
+		if payloads[mAddr].Mode == apitypes.PushModeFull {
+			st.lastFull = now
+		}
+	}
+	return nil
+}
+
+// record 保存报表需要的历史数据, 失败不影响推送
+func (p *Processor) record(mAddr address.Address, mi *apitypes.PushedMinerInfo, now time.Time) {
+	h := p.opts.History
+	if h == nil {
+		return
+	}
+	if err := h.Record(historyWorkers, mAddr.String(), now, mi.WorkerTaskState); err != nil {
+		log.Errorf("recording worker history failed, %s", err)
+	}
+	available := make(map[string]int64, len(mi.StorageInfo))
+	for _, si := range mi.StorageInfo {
+		if si.Capacity != 0 {
+			available[si.ID] = si.Available
+		}
+	}
+	if err := h.Record(historyStorage, mAddr.String(), now, available); err != nil {
+		log.Errorf("recording storage history failed, %s", err)
+	}
+	if p.opts.Retention > 0 {
+		for _, kind := range []string{historyWorkers, historyStorage} {
+			if _, err := h.Prune(kind, mAddr.String(), now.Add(-p.opts.Retention)); err != nil {
+				log.Errorf("pruning %s history failed, %s", kind, err)
+			}
+		}
+	}
+}
+
+// recordAssets 每隔 assetsInterval 保存一次资产快照, 失败不影响推送
+func (p *Processor) recordAssets(mAddr address.Address, mi *apitypes.PushedMinerInfo, now time.Time) {
+	h := p.opts.History
+	if h == nil || !p.opts.Earnings {
+		return
+	}
+	miner := mAddr.String()
+	if now.Sub(p.assetsAt[mAddr]) >= assetsInterval {
+		if err := h.Record(historyAssets, miner, now, mi.ClusterAssetInfo); err != nil {
+			log.Errorf("recording asset history failed, %s", err)
+		} else {
+			p.assetsAt[mAddr] = now
+		}
+	}
+
+	if p.opts.EarningsRetention > 0 {
+		for _, kind := range []string{historyAssets, historyEarnings} {
+			if _, err := h.Prune(kind, miner, now.Add(-p.opts.EarningsRetention)); err != nil {
+				log.Errorf("pruning %s history failed, %s", kind, err)
+			}
+		}
+	}
+}
+
+// RunEarnings 定期扫描新的tipset保存链上收益数据. 冷启动最多回扫 apiwrapper.MaxEarningsScan, 所以不在推送时扫描
+func (p *Processor) RunEarnings(ctx context.Context, interval time.Duration) {
+	if p.opts.History == nil || !p.opts.Earnings {
+		return
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		for mAddr, apiWrapper := range p.apis {
+			p.scanEarnings(ctx, mAddr, apiWrapper)
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Processor) scanEarnings(ctx context.Context, mAddr address.Address, apiWrapper *apiwrapper.LotusAPIWrapper) {
+	h := p.opts.History
+	miner := mAddr.String()
+	from, ok := p.earningsFrom[mAddr]
+	if !ok {
+		// 重启后从最后一条记录的高度继续, 重复扫描的高度会覆盖相同的记录
+		_, data, err := h.Last(historyEarnings, miner)
+		if err != nil {
+			log.Errorf("loading earnings history failed, %s", err)
+			return
+		}
+		if data != nil {
+			var last apitypes.EpochEarnings
+			if err := json.Unmarshal(data, &last); err != nil {
+				log.Errorf("decoding earnings history failed, %s", err)
+				return
+			}
+			from = last.Height
+		}
+	}
+	epochs, next, err := apiWrapper.MinerEarnings(ctx, mAddr, from)
+	if err != nil {
+		log.Errorf("scanning miner earnings failed, %s", err)
+		return
+	}
+	for _, ee := range epochs {
+		if err := h.Record(historyEarnings, miner, time.Unix(ee.Timestamp, 0), ee); err != nil {
+			log.Errorf("recording earnings history failed, %s", err)
+			return
+		}
+	}
+	p.earningsFrom[mAddr] = next
+}
+
+// payloadFor 按推送方式决定发送完整快照还是增量, mi 会被填上推送序号
+func (p *Processor) payloadFor(mAddr address.Address, mi *apitypes.PushedMinerInfo, now time.Time) *apitypes.PushedMinerInfo {
+	mi.Mode = apitypes.PushModeFull
+	st, ok := p.states[mAddr]
+	if !ok {
+		mi.Seq = 1
+		return mi
+	}
+	mi.Seq = st.seq + 1
+	if !p.opts.Delta || now.Sub(st.lastFull) >= p.opts.FullInterval {
+		return mi
+	}
+	return deltaOf(st.acked, mi, st.seq)
 }
 
 func (p *Processor) do(body interface{}) error {
-	resp, err := p.cli.R().SetHeaders(p.proxyHeaders).SetBody(body).Post(p.proxyUrl)
+	req := p.cli.R().SetHeaders(p.proxyHeaders)
+	if p.opts.Gzip {
+		data, err := gzipJSON(body)
+		if err != nil {
+			return err
+		}
+		req.SetHeader("Content-Type", "application/json").
+			SetHeader("Content-Encoding", "gzip").
+			SetBody(data)
+	} else {
+		req.SetBody(body)
+	}
+	resp, err := req.Post(p.proxyUrl)
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode() == http.StatusOK {
+	switch resp.StatusCode() {
+	case http.StatusOK:
 		return nil
+	case http.StatusConflict:
+		return errResync
 	}
 	return fmt.Errorf("push fail, url:%s, time:%s, respStatus:%d, resBody:%s", p.proxyUrl, time.Now().String(), resp.StatusCode(), string(resp.Body()))
 }
@@ -77,7 +306,14 @@ func (p *Processor) getPushedMinerInfo(mAddr address.Address, apiWrapper *apiwra
 		return nil, err
 	}
 
+	for _, si := range storageInfo {
+		if err := si.ApplyDeclMode(p.opts.DeclMode); err != nil {
+			return nil, err
+		}
+	}
+
 	return &apitypes.PushedMinerInfo{
+		SchemaVersion:    apitypes.PushedMinerInfoSchemaVersion,
 		MinerID:          mAddr.String(),
 		ProvingInfo:      pi,
 		MinerSectorsInfo: si,
@@ -85,5 +321,50 @@ func (p *Processor) getPushedMinerInfo(mAddr address.Address, apiWrapper *apiwra
 		ClusterAssetInfo: cai,
 		StorageInfo:      storageInfo,
 		MessageCount:     len(msgs),
+		Runway:           p.runway(mAddr),
 	}, nil
 }
+
+// RunRunway 定期估算控制地址余额可维持的天数. 首次需要扫描整个窗口的tipset, 所以不在推送时计算,
+// 推送只附带最近一次的结果, 还没有结果或估算失败时为空
+func (p *Processor) RunRunway(ctx context.Context, interval time.Duration) {
+	if !p.opts.Runway {
+		return
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		for mAddr, apiWrapper := range p.apis {
+			ri, err := apiWrapper.MinerRunway(ctx, mAddr)
+			if err != nil {
+				log.Errorf("estimating runway failed, %s", err)
+			}
+			p.runwayLk.Lock()
+			p.runways[mAddr] = ri
+			p.runwayLk.Unlock()
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Processor) runway(mAddr address.Address) *apitypes.RunwayInfo {
+	p.runwayLk.Lock()
+	defer p.runwayLk.Unlock()
+	return p.runways[mAddr]
+}
+
+func gzipJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		return nil, xerrors.Errorf("encoding push body: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, xerrors.Errorf("compressing push body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
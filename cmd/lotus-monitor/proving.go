@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	lotuscli "github.com/filecoin-project/lotus/cli"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/guoxiaopeng875/lotus-adapter/apiwrapper"
+	lcli "github.com/guoxiaopeng875/lotus-adapter/cmd/cli"
+	"github.com/hako/durafmt"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+var provingCmd = &cli.Command{
+	Name:  "proving",
+	Usage: "Print the current proving period and deadline",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output format: text or json",
+			Value: "text",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := lcli.ReqContext(cctx)
+
+		api, closer, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		minerApi, mCloser, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer mCloser()
+
+		mAddr, err := minerApi.ActorAddress(ctx)
+		if err != nil {
+			return err
+		}
+
+		pi, err := apiwrapper.NewLotusAPIWrapper(api, minerApi).MinerProvingInfo(ctx, mAddr)
+		if err != nil {
+			return err
+		}
+
+		switch cctx.String("output") {
+		case "text":
+			printProvingInfo(os.Stdout, pi)
+			return nil
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(pi)
+		default:
+			return xerrors.Errorf("unknown output format: %s", cctx.String("output"))
+		}
+	},
+}
+
+// printProvingInfo 按 lotus-miner proving info 的格式输出
+func printProvingInfo(out io.Writer, pi *apitypes.ProvingInfo) {
+	epoch := func(e abi.ChainEpoch) string {
+		return lotuscli.EpochTime(pi.CurrentEpoch, e)
+	}
+
+	fmt.Fprintf(out, "Current Epoch:           %d\n", pi.CurrentEpoch)
+	fmt.Fprintf(out, "Proving Period Boundary: %d\n", pi.ProvingPeriodBoundary)
+	fmt.Fprintf(out, "Proving Period Start:    %s\n", epoch(pi.ProvingPeriodStart))
+	fmt.Fprintf(out, "Next Period Start:       %s\n\n", epoch(pi.NextPeriodStart))
+
+	fmt.Fprintf(out, "Faults:      %d (%.2f%%)\n", pi.Faults, pi.FaultRatio*100)
+	fmt.Fprintf(out, "Recovering:  %d\n\n", pi.Recovering)
+
+	fmt.Fprintf(out, "Deadline Index:       %d\n", pi.DeadlineIndex)
+	fmt.Fprintf(out, "Deadline Sectors:     %d\n", pi.DeadlineSectors)
+	fmt.Fprintf(out, "Deadline Faults:      %d\n", pi.DeadlineFaults)
+	fmt.Fprintf(out, "Deadline Open:        %s\n", epoch(pi.DeadlineOpen))
+	fmt.Fprintf(out, "Deadline Close:       %s\n", epoch(pi.DeadlineClose))
+	fmt.Fprintf(out, "Deadline Duration:    %s\n", durafmt.Parse(time.Duration(pi.DeadlineDuration)*time.Second).LimitFirstN(2))
+	fmt.Fprintf(out, "Deadline Challenge:   %s\n", epoch(pi.DeadlineChallenge))
+	fmt.Fprintf(out, "Deadline FaultCutoff: %s\n", epoch(pi.DeadlineFaultCutoff))
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+	"gopkg.in/resty.v1"
+)
+
+// 报表中单独列出的任务类型
+var reportTasks = []string{"AP", "PC1", "PC2", "C2", "FIN"}
+
+type WorkersReport struct {
+	From    time.Time       `json:"from"`
+	To      time.Time       `json:"to"`
+	Workers []*WorkerReport `json:"workers"`
+}
+
+type WorkerReport struct {
+	MinerID  string `json:"miner_id"`
+	WorkerID string `json:"worker_id"`
+	Hostname string `json:"hostname"`
+	// 任务类型: 完成情况
+	Tasks map[string]*TaskStats `json:"tasks"`
+	// 统计窗口内观察到该worker的时长(秒)
+	Observed int64 `json:"observed"`
+	// 没有任何任务的时长(秒)
+	Idle int64 `json:"idle"`
+	// 有已分配但在等待(RunWait > 0)任务的时长(秒)
+	Waiting int64 `json:"waiting"`
+}
+
+type TaskStats struct {
+	Completed int `json:"completed"`
+	// 平均耗时(秒)
+	AvgDuration int64 `json:"avg_duration"`
+
+	total time.Duration
+}
+
+type workerSnapshot struct {
+	at      time.Time
+	workers []*apitypes.WorkerTaskState
+}
+
+type reportJob struct {
+	task   string
+	sector uint64
+	start  time.Time
+}
+
+// buildWorkerReport 根据按时间排序的worker快照统计每台worker的完成任务数, 平均耗时, 空闲和等待时长.
+// 两次快照之间的状态按前一次快照计算; 间隔超过正常采集间隔3倍的时段视为监控中断, 不计入统计
+func buildWorkerReport(miner string, snaps []workerSnapshot) []*WorkerReport {
+	maxGap := 3 * medianGap(snaps)
+	reports := make(map[string]*WorkerReport)
+
+	for i := 0; i+1 < len(snaps); i++ {
+		cur, next := snaps[i], snaps[i+1]
+		dt := next.at.Sub(cur.at)
+		if dt > maxGap {
+			continue
+		}
+
+		nextJobs := make(map[string]map[reportJob]struct{}, len(next.workers))
+		for _, w := range next.workers {
+			nextJobs[w.ID] = runningJobs(w)
+		}
+
+		for _, w := range cur.workers {
+			wr, ok := reports[w.ID]
+			if !ok {
+				wr = &WorkerReport{MinerID: miner, WorkerID: w.ID, Tasks: make(map[string]*TaskStats)}
+				reports[w.ID] = wr
+			}
+			wr.Hostname = w.Hostname
+			wr.Observed += int64(dt / time.Second)
+
+			waiting := false
+			for _, ss := range w.SectorStates {
+				if ss.RunWait > 0 {
+					waiting = true
+				}
+			}
+			if len(w.SectorStates) == 0 {
+				wr.Idle += int64(dt / time.Second)
+			}
+			if waiting {
+				wr.Waiting += int64(dt / time.Second)
+			}
+
+			// worker下线时无法判断任务是否完成
+			after, ok := nextJobs[w.ID]
+			if !ok {
+				continue
+			}
+			for j := range runningJobs(w) {
+				if _, ok := after[j]; ok {
+					continue
+				}
+				ts, ok := wr.Tasks[j.task]
+				if !ok {
+					ts = &TaskStats{}
+					wr.Tasks[j.task] = ts
+				}
+				ts.Completed++
+				ts.total += next.at.Sub(j.start)
+			}
+		}
+	}
+
+	out := make([]*WorkerReport, 0, len(reports))
+	for _, wr := range reports {
+		for _, ts := range wr.Tasks {
+			ts.AvgDuration = int64(ts.total / time.Duration(ts.Completed) / time.Second)
+		}
+		out = append(out, wr)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Hostname != out[j].Hostname {
+			return out[i].Hostname < out[j].Hostname
+		}
+		return out[i].WorkerID < out[j].WorkerID
+	})
+	return out
+}
+
+func runningJobs(w *apitypes.WorkerTaskState) map[reportJob]struct{} {
+	jobs := make(map[reportJob]struct{}, len(w.SectorStates))
+	for _, ss := range w.SectorStates {
+		if ss.RunWait != 0 {
+			continue
+		}
+		jobs[reportJob{task: ss.Task, sector: ss.SectorNum, start: ss.Start}] = struct{}{}
+	}
+	return jobs
+}
+
+func medianGap(snaps []workerSnapshot) time.Duration {
+	if len(snaps) < 2 {
+		return 0
+	}
+	gaps := make([]time.Duration, 0, len(snaps)-1)
+	for i := 1; i < len(snaps); i++ {
+		gaps = append(gaps, snaps[i].at.Sub(snaps[i-1].at))
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	return gaps[len(gaps)/2]
+}
+
+// workersReport 从历史记录中读取 [from, to] 内的快照并生成报表
+func (p *Processor) workersReport(miner string, from, to time.Time) (*WorkersReport, error) {
+	rep := &WorkersReport{From: from, To: to, Workers: []*WorkerReport{}}
+	for mAddr := range p.apis {
+		if miner != "" && miner != mAddr.String() {
+			continue
+		}
+		var snaps []workerSnapshot
+		err := p.opts.History.Range(historyWorkers, mAddr.String(), from, to, func(at time.Time, data []byte) error {
+			var ws []*apitypes.WorkerTaskState
+			if err := json.Unmarshal(data, &ws); err != nil {
+				return err
+			}
+			snaps = append(snaps, workerSnapshot{at: at, workers: ws})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		rep.Workers = append(rep.Workers, buildWorkerReport(mAddr.String(), snaps)...)
+	}
+	return rep, nil
+}
+
+// /report/workers?since=24h&miner=<minerID>
+func (p *Processor) handleWorkersReport(w http.ResponseWriter, r *http.Request) {
+	since := time.Hour * 24
+	if s := r.URL.Query().Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+	now := time.Now()
+	rep, err := p.workersReport(r.URL.Query().Get("miner"), now.Add(-since), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
+
+var reportCmd = &cli.Command{
+	Name:  "report",
+	Usage: "Print reports built from the history recorded by a running lotus monitor",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "monitor-api",
+			Usage: "address of the running monitor's --listen endpoint",
+			Value: "http://127.0.0.1:8875",
+		},
+	},
+	Subcommands: []*cli.Command{
+		reportWorkersCmd,
+		reportEarningsCmd,
+	},
+}
+
+var reportWorkersCmd = &cli.Command{
+	Name:  "workers",
+	Usage: "Per-worker completed tasks, average durations, idle and waiting time",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "since",
+			Usage: "report window, ending now",
+			Value: 24 * time.Hour,
+		},
+		&cli.StringFlag{
+			Name:  "miner",
+			Usage: "only report workers of this miner",
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output format: table, csv or json",
+			Value: "table",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		resp, err := resty.New().R().
+			SetQueryParam("since", cctx.Duration("since").String()).
+			SetQueryParam("miner", cctx.String("miner")).
+			Get(cctx.String("monitor-api") + "/report/workers")
+		if err != nil {
+			return xerrors.Errorf("requesting report: %w", err)
+		}
+		if resp.StatusCode() != http.StatusOK {
+			return xerrors.Errorf("requesting report: %d %s", resp.StatusCode(), string(resp.Body()))
+		}
+		var rep WorkersReport
+		if err := json.Unmarshal(resp.Body(), &rep); err != nil {
+			return xerrors.Errorf("decoding report: %w", err)
+		}
+
+		switch cctx.String("output") {
+		case "table":
+			return printWorkersTable(os.Stdout, &rep)
+		case "csv":
+			return printWorkersCSV(os.Stdout, &rep)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(&rep)
+		default:
+			return xerrors.Errorf("unknown output format: %s", cctx.String("output"))
+		}
+	},
+}
+
+func printWorkersTable(out io.Writer, rep *WorkersReport) error {
+	fmt.Fprintf(out, "%s - %s\n", rep.From.Format(time.RFC3339), rep.To.Format(time.RFC3339))
+	tw := tabwriter.NewWriter(out, 2, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "MINER\tHOSTNAME\tWORKER")
+	for _, task := range reportTasks {
+		fmt.Fprintf(tw, "\t%s", task)
+	}
+	fmt.Fprint(tw, "\tIDLE\tWAITING\n")
+	for _, wr := range rep.Workers {
+		fmt.Fprintf(tw, "%s\t%s\t%s", wr.MinerID, wr.Hostname, wr.WorkerID)
+		for _, task := range reportTasks {
+			ts, ok := wr.Tasks[task]
+			if !ok {
+				fmt.Fprint(tw, "\t-")
+				continue
+			}
+			fmt.Fprintf(tw, "\t%d (avg %s)", ts.Completed, time.Duration(ts.AvgDuration)*time.Second)
+		}
+		fmt.Fprintf(tw, "\t%s\t%s\n", ratio(wr.Idle, wr.Observed), ratio(wr.Waiting, wr.Observed))
+	}
+	return tw.Flush()
+}
+
+func ratio(part, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%.1f%%)", time.Duration(part)*time.Second, float64(part)*100/float64(total))
+}
+
+func printWorkersCSV(out io.Writer, rep *WorkersReport) error {
+	w := csv.NewWriter(out)
+	header := []string{"miner_id", "hostname", "worker_id"}
+	for _, task := range reportTasks {
+		header = append(header, task+"_completed", task+"_avg_seconds")
+	}
+	header = append(header, "observed_seconds", "idle_seconds", "waiting_seconds")
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, wr := range rep.Workers {
+		row := []string{wr.MinerID, wr.Hostname, wr.WorkerID}
+		for _, task := range reportTasks {
+			ts, ok := wr.Tasks[task]
+			if !ok {
+				ts = &TaskStats{}
+			}
+			row = append(row, strconv.Itoa(ts.Completed), strconv.FormatInt(ts.AvgDuration, 10))
+		}
+		row = append(row, strconv.FormatInt(wr.Observed, 10), strconv.FormatInt(wr.Idle, 10), strconv.FormatInt(wr.Waiting, 10))
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildWorkerReport(t *testing.T) {
+	t0 := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+	pc1 := &apitypes.SectorState{Task: "PC1", SectorNum: 1, Start: at(0)}
+	waiting := &apitypes.SectorState{Task: "PC2", SectorNum: 2, Start: at(0), RunWait: 1}
+
+	snaps := []workerSnapshot{
+		{at: at(0), workers: []*apitypes.WorkerTaskState{
+			{ID: "w1", Hostname: "h1", SectorStates: []*apitypes.SectorState{pc1, waiting}},
+			{ID: "w2", Hostname: "h2"},
+		}},
+		{at: at(1), workers: []*apitypes.WorkerTaskState{
+			{ID: "w1", Hostname: "h1", SectorStates: []*apitypes.SectorState{pc1}},
+			{ID: "w2", Hostname: "h2"},
+		}},
+		{at: at(2), workers: []*apitypes.WorkerTaskState{
+			{ID: "w1", Hostname: "h1"},
+			{ID: "w2", Hostname: "h2"},
+		}},
+		// 监控中断, 不计入统计
+		{at: at(60), workers: []*apitypes.WorkerTaskState{
+			{ID: "w1", Hostname: "h1"},
+		}},
+		{at: at(61), workers: []*apitypes.WorkerTaskState{
+			{ID: "w1", Hostname: "h1"},
+		}},
+	}
+
+	rep := buildWorkerReport("f01000", snaps)
+	require.Len(t, rep, 2)
+
+	w1 := rep[0]
+	require.Equal(t, "w1", w1.WorkerID)
+	require.Equal(t, int64(180), w1.Observed)
+	require.Equal(t, int64(60), w1.Idle)
+	require.Equal(t, int64(60), w1.Waiting)
+	require.Equal(t, 1, w1.Tasks["PC1"].Completed)
+	require.Equal(t, int64(120), w1.Tasks["PC1"].AvgDuration)
+	require.NotContains(t, w1.Tasks, "PC2")
+
+	w2 := rep[1]
+	require.Equal(t, int64(120), w2.Observed)
+	require.Equal(t, int64(120), w2.Idle)
+}
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(dssync.MutexWrap(datastore.NewMapDatastore()))
+	t0 := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, h.Record(historyWorkers, "f01000", t0.Add(time.Duration(i)*time.Hour), i))
+	}
+	require.NoError(t, h.Record(historyWorkers, "f01001", t0, 100))
+
+	var got []int
+	collect := func(at time.Time, data []byte) error {
+		var v int
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		got = append(got, v)
+		return nil
+	}
+	require.NoError(t, h.Range(historyWorkers, "f01000", t0.Add(time.Hour), t0.Add(3*time.Hour), collect))
+	require.Equal(t, []int{1, 2, 3}, got)
+
+	n, err := h.Prune(historyWorkers, "f01000", t0.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	got = nil
+	require.NoError(t, h.Range(historyWorkers, "f01000", t0, t0.Add(time.Hour*24), collect))
+	require.Equal(t, []int{2, 3, 4}, got)
+
+	got = nil
+	require.NoError(t, h.Range(historyWorkers, "f01001", t0, t0, collect))
+	require.Equal(t, []int{100}, got)
+
+	// 跨天的记录按天分组保存, 查询范围跨过日期边界
+	for i := 5; i < 8; i++ {
+		require.NoError(t, h.Record(historyWorkers, "f01000", t0.Add(time.Duration(i)*12*time.Hour), i))
+	}
+	got = nil
+	require.NoError(t, h.Range(historyWorkers, "f01000", t0.Add(4*time.Hour), t0.Add(72*time.Hour), collect))
+	require.Equal(t, []int{4, 5, 6}, got)
+	got = nil
+	require.NoError(t, h.Range(historyWorkers, "f01000", time.Time{}, t0.Add(1000*time.Hour), collect))
+	require.Equal(t, []int{2, 3, 4, 5, 6, 7}, got)
+	at, _, err := h.Last(historyWorkers, "f01000")
+	require.NoError(t, err)
+	require.True(t, at.Equal(t0.Add(84*time.Hour)))
+
+	got = nil
+	require.NoError(t, h.Range(historyWorkers, "f01002", time.Time{}, t0, collect))
+	require.Nil(t, got)
+}
@@ -1,26 +1,88 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"github.com/gin-gonic/gin"
+	"os"
+	"path/filepath"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/lib/lotuslog"
+	leveldb "github.com/ipfs/go-ds-leveldb"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
 )
 
+var log = logging.Logger("main")
+
 func main() {
-	r := gin.Default()
-	r.POST("/notify_task", func(c *gin.Context) {
-		var req map[string]interface{}
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(400, gin.H{
-				"success": false,
-			})
-			return
+	lotuslog.SetupLogLevels()
+
+	local := []*cli.Command{
+		runCmd,
+	}
+
+	app := &cli.App{
+		Name:     "lotus-task-watcher",
+		Usage:    "receive and query sealing task events",
+		Version:  build.UserVersion(),
+		Commands: local,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "repo",
+				EnvVars: []string{"LOTUS_TASK_WATCHER_PATH"},
+				Value:   "~/.lotustaskwatcher",
+			},
+		},
+	}
+	app.Setup()
+
+	if err := app.Run(os.Args); err != nil {
+		log.Warnf("%+v", err)
+		return
+	}
+}
+
+var runCmd = &cli.Command{
+	Name:  "run",
+	Usage: "Start lotus task watcher",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "host address and port the watcher will listen on",
+			Value: "0.0.0.0:8080",
+		},
+		&cli.StringFlag{
+			Name:    "token",
+			EnvVars: []string{"TASK_WATCHER_TOKEN"},
+			Usage:   "shared token senders and clients must present as 'Authorization: Bearer <token>'",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		token := cctx.String("token")
+		if token == "" {
+			return xerrors.New("--token is required")
 		}
-		data, _ := json.MarshalIndent(req, "", " ")
-		fmt.Println(string(data))
-		c.JSON(200, gin.H{
-			"success": true,
-		})
-	})
-	r.Run() // listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
+
+		p, err := homedir.Expand(cctx.String("repo"))
+		if err != nil {
+			return xerrors.Errorf("could not expand home dir: %w", err)
+		}
+		if err := os.MkdirAll(p, 0755); err != nil {
+			return err
+		}
+		ds, err := leveldb.NewDatastore(filepath.Join(p, "datastore"), nil)
+		if err != nil {
+			return xerrors.Errorf("opening datastore: %w", err)
+		}
+		defer ds.Close() //nolint:errcheck
+
+		store, err := NewEventStore(ds)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Starting lotus task watcher on %s", cctx.String("listen"))
+		return newRouter(store, token).Run(cctx.String("listen"))
+	},
 }
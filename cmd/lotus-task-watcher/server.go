@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+)
+
+func newRouter(store *EventStore, token string) *gin.Engine {
+	r := gin.Default()
+	g := r.Group("/", tokenAuth(token))
+
+	g.POST("/notify_task", func(c *gin.Context) {
+		var ev apitypes.TaskEvent
+		if err := c.BindJSON(&ev); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := validateEvent(&ev); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		ev.ID = 0
+		ev.ReceivedAt = time.Now()
+		if err := store.Put(&ev); err != nil {
+			fail(c, http.StatusInternalServerError, err)
+			return
+		}
+		log.Infow("task event", "miner", ev.MinerID, "sector", ev.SectorNum, "task", ev.Task, "worker", ev.Worker, "result", ev.Result)
+		ok(c, gin.H{"id": ev.ID})
+	})
+
+	g.GET("/sectors/:miner/:sector/timeline", func(c *gin.Context) {
+		sector, err := strconv.ParseUint(c.Param("sector"), 10, 64)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		evs, err := store.SectorTimeline(c.Param("miner"), sector)
+		if err != nil {
+			fail(c, http.StatusInternalServerError, err)
+			return
+		}
+		ok(c, evs)
+	})
+
+	g.GET("/workers/:worker/history", func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 0 {
+			fail(c, http.StatusBadRequest, fmt.Errorf("invalid limit: %s", c.Query("limit")))
+			return
+		}
+		evs, err := store.WorkerHistory(c.Param("worker"), limit)
+		if err != nil {
+			fail(c, http.StatusInternalServerError, err)
+			return
+		}
+		ok(c, evs)
+	})
+
+	// ?since=24h 或 ?from=<RFC3339>&to=<RFC3339>
+	g.GET("/failures", func(c *gin.Context) {
+		from, to, err := parseWindow(c)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		evs, err := store.Failures(from, to)
+		if err != nil {
+			fail(c, http.StatusInternalServerError, err)
+			return
+		}
+		ok(c, evs)
+	})
+
+	return r
+}
+
+func tokenAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			fail(c, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func validateEvent(ev *apitypes.TaskEvent) error {
+	switch {
+	case ev.MinerID == "":
+		return fmt.Errorf("miner_id is required")
+	case ev.Task == "":
+		return fmt.Errorf("task is required")
+	case ev.Worker == "":
+		return fmt.Errorf("worker is required")
+	case ev.Start.IsZero():
+		return fmt.Errorf("start is required")
+	case ev.End != nil && ev.End.Before(ev.Start):
+		return fmt.Errorf("end is before start")
+	}
+	switch ev.Result {
+	case apitypes.TaskResultStarted, apitypes.TaskResultOK, apitypes.TaskResultFailed:
+	default:
+		return fmt.Errorf("unknown result %q", ev.Result)
+	}
+	return nil
+}
+
+func parseWindow(c *gin.Context) (time.Time, time.Time, error) {
+	now := time.Now()
+	if since := c.Query("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return now.Add(-d), now, nil
+	}
+
+	from, to := now.Add(-24*time.Hour), now
+	var err error
+	if s := c.Query("from"); s != "" {
+		if from, err = time.Parse(time.RFC3339, s); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if to, err = time.Parse(time.RFC3339, s); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	return from, to, nil
+}
+
+func ok(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+	})
+}
+
+func fail(c *gin.Context, code int, err error) {
+	c.JSON(code, gin.H{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+)
+
+// 数据布局:
+//
+//	/meta/seq                                  最近分配的事件ID
+//	/events/<id>                               事件
+//	/idx/sector/<miner>/<sector>/<id>          按扇区索引
+//	/idx/worker/<worker>/<id>                  按worker索引
+//	/idx/failed/<unix nano>/<id>               失败事件按结束时间索引
+var (
+	seqKey          = datastore.NewKey("/meta/seq")
+	eventsPrefix    = datastore.NewKey("/events")
+	sectorIdxPrefix = datastore.NewKey("/idx/sector")
+	workerIdxPrefix = datastore.NewKey("/idx/worker")
+	failedIdxPrefix = datastore.NewKey("/idx/failed")
+)
+
+type EventStore struct {
+	lk  sync.Mutex
+	ds  datastore.Batching
+	seq uint64
+}
+
+func NewEventStore(ds datastore.Batching) (*EventStore, error) {
+	s := &EventStore{ds: ds}
+	b, err := ds.Get(seqKey)
+	switch err {
+	case nil:
+		s.seq = binary.BigEndian.Uint64(b)
+	case datastore.ErrNotFound:
+	default:
+		return nil, xerrors.Errorf("loading event sequence: %w", err)
+	}
+	return s, nil
+}
+
+// Put 保存事件并分配ID
+func (s *EventStore) Put(ev *apitypes.TaskEvent) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	ev.ID = s.seq + 1
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	id := idString(ev.ID)
+	b, err := s.ds.Batch()
+	if err != nil {
+		return err
+	}
+	seq := make([]byte, 8)
+	binary.BigEndian.PutUint64(seq, ev.ID)
+	puts := map[datastore.Key][]byte{
+		seqKey:                       seq,
+		eventsPrefix.ChildString(id): data,
+		sectorIdxPrefix.ChildString(escape(ev.MinerID)).ChildString(strconv.FormatUint(ev.SectorNum, 10)).ChildString(id): nil,
+		workerIdxPrefix.ChildString(escape(ev.Worker)).ChildString(id):                                                    nil,
+	}
+	if ev.Result == apitypes.TaskResultFailed {
+		puts[failedIdxPrefix.ChildString(timeString(eventTime(ev))).ChildString(id)] = nil
+	}
+	for k, v := range puts {
+		if err := b.Put(k, v); err != nil {
+			return err
+		}
+	}
+	if err := b.Commit(); err != nil {
+		return xerrors.Errorf("saving task event: %w", err)
+	}
+	s.seq = ev.ID
+	return nil
+}
+
+// SectorTimeline 返回扇区的全部事件, 按开始时间排序
+func (s *EventStore) SectorTimeline(miner string, sector uint64) ([]*apitypes.TaskEvent, error) {
+	evs, err := s.fromIndex(sectorIdxPrefix.ChildString(escape(miner)).ChildString(strconv.FormatUint(sector, 10)), 0)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(evs, func(i, j int) bool {
+		return evs[i].Start.Before(evs[j].Start)
+	})
+	return evs, nil
+}
+
+// WorkerHistory 返回worker最近的 limit 个事件, 新的在前
+func (s *EventStore) WorkerHistory(worker string, limit int) ([]*apitypes.TaskEvent, error) {
+	return s.fromIndex(workerIdxPrefix.ChildString(escape(worker)), limit)
+}
+
+// Failures 返回结束时间在 [from, to) 内的失败事件
+func (s *EventStore) Failures(from, to time.Time) ([]*apitypes.TaskEvent, error) {
+	res, err := s.ds.Query(query.Query{
+		Prefix:   failedIdxPrefix.String(),
+		KeysOnly: true,
+		Orders:   []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close() //nolint:errcheck
+
+	lo, hi := timeString(from), timeString(to)
+	var out []*apitypes.TaskEvent
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		ns := datastore.NewKey(r.Key).Namespaces()
+		ts := ns[len(ns)-2]
+		if ts < lo || ts >= hi {
+			continue
+		}
+		ev, err := s.get(ns[len(ns)-1])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+func (s *EventStore) fromIndex(prefix datastore.Key, limit int) ([]*apitypes.TaskEvent, error) {
+	res, err := s.ds.Query(query.Query{
+		Prefix:   prefix.String(),
+		KeysOnly: true,
+		Orders:   []query.Order{query.OrderByKeyDescending{}},
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []*apitypes.TaskEvent
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		ev, err := s.get(datastore.NewKey(r.Key).BaseNamespace())
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+func (s *EventStore) get(id string) (*apitypes.TaskEvent, error) {
+	b, err := s.ds.Get(eventsPrefix.ChildString(id))
+	if err != nil {
+		return nil, xerrors.Errorf("getting task event %s: %w", id, err)
+	}
+	var ev apitypes.TaskEvent
+	if err := json.Unmarshal(b, &ev); err != nil {
+		return nil, xerrors.Errorf("decoding task event %s: %w", id, err)
+	}
+	return &ev, nil
+}
+
+func eventTime(ev *apitypes.TaskEvent) time.Time {
+	if ev.End != nil {
+		return *ev.End
+	}
+	return ev.ReceivedAt
+}
+
+// 定长数字保证按key排序即按数值排序
+func idString(id uint64) string {
+	return fmt.Sprintf("%020d", id)
+}
+
+func timeString(t time.Time) string {
+	if t.UnixNano() < 0 {
+		return idString(0)
+	}
+	return idString(uint64(t.UnixNano()))
+}
+
+func escape(s string) string {
+	return url.PathEscape(s)
+}
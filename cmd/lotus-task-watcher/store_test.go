@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStore(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	s, err := NewEventStore(ds)
+	require.NoError(t, err)
+
+	start := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(3 * time.Hour)
+	failedAt := start.Add(5 * time.Hour)
+	events := []*apitypes.TaskEvent{
+		{MinerID: "f01000", SectorNum: 1, Task: "PC1", Worker: "host1", Start: start, End: &end, Result: apitypes.TaskResultOK},
+		{MinerID: "f01000", SectorNum: 1, Task: "PC2", Worker: "host10", Start: end, End: &failedAt, Result: apitypes.TaskResultFailed, Error: "boom"},
+		{MinerID: "f01000", SectorNum: 10, Task: "PC1", Worker: "host1", Start: start, Result: apitypes.TaskResultStarted},
+	}
+	for _, ev := range events {
+		require.NoError(t, s.Put(ev))
+	}
+	require.Equal(t, uint64(3), events[2].ID)
+
+	tl, err := s.SectorTimeline("f01000", 1)
+	require.NoError(t, err)
+	require.Len(t, tl, 2)
+	require.Equal(t, "PC1", tl[0].Task)
+	require.Equal(t, "PC2", tl[1].Task)
+
+	hist, err := s.WorkerHistory("host1", 10)
+	require.NoError(t, err)
+	require.Len(t, hist, 2)
+	require.Equal(t, uint64(3), hist[0].ID)
+
+	hist, err = s.WorkerHistory("host1", 1)
+	require.NoError(t, err)
+	require.Len(t, hist, 1)
+
+	fails, err := s.Failures(start, start.Add(6*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, fails, 1)
+	require.Equal(t, "boom", fails[0].Error)
+
+	fails, err = s.Failures(start, start.Add(4*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, fails)
+
+	// 重新打开后继续分配ID
+	s2, err := NewEventStore(ds)
+	require.NoError(t, err)
+	ev := &apitypes.TaskEvent{MinerID: "f01000", SectorNum: 2, Task: "AP", Worker: "host2", Start: start, Result: apitypes.TaskResultStarted}
+	require.NoError(t, s2.Put(ev))
+	require.Equal(t, uint64(4), ev.ID)
+}
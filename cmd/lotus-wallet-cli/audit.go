@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/guoxiaopeng875/lotus-adapter/envelope"
+	"github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// 钱包目录中的签名审计日志, 每行一条JSON记录
+const auditFile = "audit.log"
+
+// auditEntry 一次签名的记录. Hash 是去掉 Hash 后的记录的sha256, 记录中包含上一条的 Hash, 修改或删除中间的记录都会导致校验失败
+type auditEntry struct {
+	Seq    uint64          `json:"seq"`
+	Time   time.Time       `json:"time"`
+	Signer address.Address `json:"signer"`
+	Type   api.MsgType     `json:"type"`
+	// 签名链上消息时的消息内容
+	Message *auditMessage `json:"message,omitempty"`
+	// 签名其他数据时的原始数据
+	Data    string   `json:"data,omitempty"`
+	Summary []string `json:"summary,omitempty"`
+	Prev    string   `json:"prev"`
+	Hash    string   `json:"hash"`
+}
+
+type auditMessage struct {
+	Cid    cid.Cid         `json:"cid"`
+	From   address.Address `json:"from"`
+	To     address.Address `json:"to"`
+	Value  abi.TokenAmount `json:"value"`
+	Method abi.MethodNum   `json:"method"`
+	Nonce  uint64          `json:"nonce"`
+}
+
+func (e *auditEntry) computeHash() (string, error) {
+	c := *e
+	c.Hash = ""
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readAudit 读取并校验审计日志, 返回全部记录. 文件不存在时返回空
+func readAudit(path string) ([]*auditEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*auditEntry
+	prev := ""
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, xerrors.Errorf("line %d: decoding entry: %w", line, err)
+		}
+		if e.Seq != uint64(line) {
+			return nil, xerrors.Errorf("line %d: unexpected sequence number %d", line, e.Seq)
+		}
+		if e.Prev != prev {
+			return nil, xerrors.Errorf("line %d: previous hash %s does not match %s", line, e.Prev, prev)
+		}
+		h, err := e.computeHash()
+		if err != nil {
+			return nil, xerrors.Errorf("line %d: %w", line, err)
+		}
+		if h != e.Hash {
+			return nil, xerrors.Errorf("line %d: entry hash mismatch, the entry was modified", line)
+		}
+		prev = e.Hash
+		entries = append(entries, &e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// appendAudit 校验已有的日志后追加一条记录, 已有日志被篡改时拒绝写入
+func appendAudit(path string, e *auditEntry) error {
+	entries, err := readAudit(path)
+	if err != nil {
+		return xerrors.Errorf("verifying audit log: %w", err)
+	}
+	e.Seq = uint64(len(entries)) + 1
+	e.Prev = ""
+	if len(entries) > 0 {
+		e.Prev = entries[len(entries)-1].Hash
+	}
+	if e.Hash, err = e.computeHash(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close() // nolint
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close() // nolint
+		return err
+	}
+	return f.Close()
+}
+
+type actorsKey struct{}
+
+// withActors 在context中带上已知的actor类型, 审计日志用于解析消息
+func withActors(ctx context.Context, actors map[address.Address]string) context.Context {
+	return context.WithValue(ctx, actorsKey{}, actors)
+}
+
+// newAuditEntry 根据签名请求生成记录
+func newAuditEntry(ctx context.Context, signer address.Address, toSign []byte, meta api.MsgMeta) *auditEntry {
+	e := &auditEntry{
+		Time:   time.Now().UTC(),
+		Signer: signer,
+		Type:   meta.Type,
+	}
+	if meta.Type == api.MTChainMsg {
+		if msg, err := types.DecodeMessage(meta.Extra); err == nil {
+			actors, _ := ctx.Value(actorsKey{}).(map[address.Address]string)
+			e.Message = &auditMessage{
+				Cid:    msg.Cid(),
+				From:   msg.From,
+				To:     msg.To,
+				Value:  msg.Value,
+				Method: msg.Method,
+				Nonce:  msg.Nonce,
+			}
+			e.Summary = envelope.Describe(msg, actors)
+			return e
+		}
+	}
+	e.Data = hex.EncodeToString(toSign)
+	return e
+}
+
+// auditWallet 签名成功后写入审计日志, 写入失败时不返回签名
+type auditWallet struct {
+	api.WalletAPI
+	path string
+}
+
+func (w *auditWallet) WalletSign(ctx context.Context, signer address.Address, toSign []byte, meta api.MsgMeta) (*crypto.Signature, error) {
+	sig, err := w.WalletAPI.WalletSign(ctx, signer, toSign, meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := appendAudit(w.path, newAuditEntry(ctx, signer, toSign, meta)); err != nil {
+		return nil, xerrors.Errorf("writing audit log: %w", err)
+	}
+	return sig, nil
+}
+
+func auditPath(cctx *cli.Context) (string, error) {
+	lr, err := openRepo(cctx)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(lr.Path(), auditFile), nil
+}
+
+var auditCmd = &cli.Command{
+	Name:  "audit",
+	Usage: "Inspect the signing audit log",
+	Subcommands: []*cli.Command{
+		auditVerifyCmd,
+		auditListCmd,
+	},
+}
+
+var auditVerifyCmd = &cli.Command{
+	Name:  "verify",
+	Usage: "Verify the hash chain of the audit log",
+	Description: `Modified or removed entries are detected. Entries removed from the end
+   can only be noticed by comparing the head hash with one recorded earlier.`,
+	Action: func(cctx *cli.Context) error {
+		path, err := auditPath(cctx)
+		if err != nil {
+			return err
+		}
+		entries, err := readAudit(path)
+		if err != nil {
+			return xerrors.Errorf("audit log %s is corrupted: %w", path, err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("audit log is empty")
+			return nil
+		}
+		last := entries[len(entries)-1]
+		fmt.Printf("%d entries OK, last at %s\n", len(entries), last.Time.Local().Format("2006-01-02 15:04:05"))
+		fmt.Printf("head: %s\n", last.Hash)
+		return nil
+	},
+}
+
+var auditListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List signed messages in the audit log",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "signer",
+			Usage: "only show entries signed by this address",
+		},
+		&cli.StringFlag{
+			Name:  "to",
+			Usage: "only show messages sent to this address",
+		},
+		&cli.Int64Flag{
+			Name:  "method",
+			Usage: "only show messages calling this method number",
+			Value: -1,
+		},
+		&cli.StringFlag{
+			Name:  "cid",
+			Usage: "only show the message with this cid",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only show entries signed at or after this date, e.g. 2006-01-02 or 2006-01-02T15:04:05",
+		},
+		&cli.StringFlag{
+			Name:  "until",
+			Usage: "only show entries signed before this date",
+		},
+		&cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "print the decoded message summaries",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the entries as json",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		filter, err := parseAuditFilter(cctx)
+		if err != nil {
+			return err
+		}
+		path, err := auditPath(cctx)
+		if err != nil {
+			return err
+		}
+		entries, err := readAudit(path)
+		if err != nil {
+			return xerrors.Errorf("audit log %s is corrupted: %w", path, err)
+		}
+
+		for _, e := range entries {
+			if !filter.match(e) {
+				continue
+			}
+			if cctx.Bool("json") {
+				b, err := json.Marshal(e)
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(b))
+				continue
+			}
+			fmt.Println(e.line())
+			if cctx.Bool("verbose") {
+				for _, l := range e.Summary {
+					fmt.Printf("    %s\n", l)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+func (e *auditEntry) line() string {
+	at := e.Time.Local().Format("2006-01-02 15:04:05")
+	if e.Message == nil {
+		return fmt.Sprintf("%d\t%s\t%s\t%s data %s", e.Seq, at, e.Signer, e.Type, e.Data)
+	}
+	m := e.Message
+	return fmt.Sprintf("%d\t%s\t%s\t%s\tto %s\t%s\tmethod %d\tnonce %d",
+		e.Seq, at, m.Cid, m.From, m.To, types.FIL(m.Value), m.Method, m.Nonce)
+}
+
+type auditFilter struct {
+	signer, to   address.Address
+	method       int64
+	cid          cid.Cid
+	since, until time.Time
+}
+
+func parseAuditFilter(cctx *cli.Context) (*auditFilter, error) {
+	f := &auditFilter{method: cctx.Int64("method")}
+	var err error
+	if s := cctx.String("signer"); s != "" {
+		if f.signer, err = address.NewFromString(s); err != nil {
+			return nil, xerrors.Errorf("parsing signer: %w", err)
+		}
+	}
+	if s := cctx.String("to"); s != "" {
+		if f.to, err = address.NewFromString(s); err != nil {
+			return nil, xerrors.Errorf("parsing to: %w", err)
+		}
+	}
+	if s := cctx.String("cid"); s != "" {
+		if f.cid, err = cid.Decode(s); err != nil {
+			return nil, xerrors.Errorf("parsing cid: %w", err)
+		}
+	}
+	if f.since, err = parseAuditTime(cctx.String("since")); err != nil {
+		return nil, xerrors.Errorf("parsing since: %w", err)
+	}
+	if f.until, err = parseAuditTime(cctx.String("until")); err != nil {
+		return nil, xerrors.Errorf("parsing until: %w", err)
+	}
+	return f, nil
+}
+
+// parseAuditTime 按本地时区解析日期或时间
+func parseAuditTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	layout := "2006-01-02"
+	if strings.Contains(s, "T") {
+		layout = "2006-01-02T15:04:05"
+	}
+	return time.ParseInLocation(layout, s, time.Local)
+}
+
+func (f *auditFilter) match(e *auditEntry) bool {
+	if f.signer != address.Undef && e.Signer != f.signer {
+		return false
+	}
+	if !f.since.IsZero() && e.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !e.Time.Before(f.until) {
+		return false
+	}
+	if f.to == address.Undef && f.method < 0 && !f.cid.Defined() {
+		return true
+	}
+	// 按消息内容过滤时跳过其他数据的签名
+	if e.Message == nil {
+		return false
+	}
+	if f.to != address.Undef && e.Message.To != f.to {
+		return false
+	}
+	if f.method >= 0 && e.Message.Method != abi.MethodNum(f.method) {
+		return false
+	}
+	if f.cid.Defined() && e.Message.Cid != f.cid {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), auditFile)
+	signer, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	to, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < 3; i++ {
+		msg := &types.Message{From: signer, To: to, Value: types.FromFil(i), Nonce: i}
+		mb, err := msg.ToStorageBlock()
+		require.NoError(t, err)
+		e := newAuditEntry(context.Background(), signer, mb.Cid().Bytes(), api.MsgMeta{Type: api.MTChainMsg, Extra: mb.RawData()})
+		require.NoError(t, appendAudit(path, e))
+	}
+	require.NoError(t, appendAudit(path, newAuditEntry(context.Background(), signer, []byte("data"), api.MsgMeta{Type: api.MTUnknown})))
+
+	entries, err := readAudit(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.Equal(t, entries[0].Hash, entries[1].Prev)
+	require.Contains(t, entries[2].Summary, "Value:       2 FIL")
+	require.Equal(t, "64617461", entries[3].Data)
+
+	f := &auditFilter{to: to, method: -1}
+	require.True(t, f.match(entries[0]))
+	require.False(t, f.match(entries[3]))
+
+	// 修改金额后校验失败, 也不能继续追加
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	tampered := strings.Replace(string(b), `"value":"1000000000000000000"`, `"value":"1"`, 1)
+	require.NotEqual(t, string(b), tampered)
+	require.NoError(t, ioutil.WriteFile(path, []byte(tampered), 0600))
+	_, err = readAudit(path)
+	require.EqualError(t, err, "line 2: entry hash mismatch, the entry was modified")
+	require.Error(t, appendAudit(path, entries[3]))
+
+	// 删除中间的记录
+	lines := strings.SplitAfter(string(b), "\n")
+	require.NoError(t, ioutil.WriteFile(path, []byte(lines[0]+lines[2]), 0600))
+	_, err = readAudit(path)
+	require.EqualError(t, err, "line 2: unexpected sequence number 3")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/guoxiaopeng875/lotus-adapter/envelope"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+var signEnvelopeCmd = &cli.Command{
+	Name:      "sign-envelope",
+	Usage:     "Sign a message envelope written by mpool-push prepare after confirmation",
+	ArgsUsage: "<envelopeFile>",
+	Flags: []cli.Flag{
+		yesFlag(),
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "file the signed envelope is written to, - writes stdout",
+			Value: "-",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		// 标准输入用于确认, 信封只能从文件读取
+		if cctx.Args().Len() != 1 || cctx.Args().First() == "-" {
+			return ShowHelp(cctx, xerrors.New("must specify the envelope file"))
+		}
+		e, err := envelope.Read(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+		if e.Signature != nil {
+			return xerrors.New("envelope is already signed")
+		}
+
+		actors, err := e.ActorKinds()
+		if err != nil {
+			return err
+		}
+		// 不使用信封里的说明, 根据消息重新生成
+		fmt.Fprintf(os.Stderr, "Message %s prepared at %s\n", e.Cid, e.PreparedAt.Format("2006-01-02 15:04:05"))
+		if len(actors) > 0 {
+			fmt.Fprintln(os.Stderr, "Actor types below were reported by the online node")
+		}
+		if err := confirmSign(cctx, envelope.Describe(e.Message, actors)); err != nil {
+			return err
+		}
+
+		walletAPI, err := newWalletAPI(cctx)
+		if err != nil {
+			return err
+		}
+		sm, err := signMessage(withActors(cctx.Context, actors), walletAPI, e.Message)
+		if err != nil {
+			return err
+		}
+		e.Signature = &sm.Signature
+		return envelope.Write(cctx.String("output"), e)
+	},
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/wallet"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+	"golang.org/x/xerrors"
+)
+
+// 导入导出私钥支持的格式
+const (
+	formatHexLotus  = "hex-lotus"
+	formatJSONLotus = "json-lotus"
+	formatGFCJSON   = "gfc-json"
+	// web3 v3 格式的口令加密私钥文件
+	formatKeyfile = "keyfile"
+	// 32字节secp256k1私钥的hex
+	formatSecpHex = "secp256k1-hex"
+	// json-lotus 的base32, 只有大写字母和数字, 适合二维码
+	formatBase32 = "base32"
+)
+
+var keyFormats = []string{formatHexLotus, formatJSONLotus, formatGFCJSON, formatKeyfile, formatSecpHex, formatBase32}
+
+var qrEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// gfcKey go-filecoin 导出的私钥格式
+type gfcKey struct {
+	KeyInfo []struct {
+		PrivateKey []byte
+		SigType    int
+	}
+}
+
+// encodeKey 按格式编码私钥, keyfile 格式需要口令
+func encodeKey(addr address.Address, ki *types.KeyInfo, format string, password func() (string, error)) ([]byte, error) {
+	switch format {
+	case formatHexLotus, formatJSONLotus, formatBase32:
+		b, err := json.Marshal(ki)
+		if err != nil {
+			return nil, err
+		}
+		switch format {
+		case formatHexLotus:
+			return []byte(hex.EncodeToString(b)), nil
+		case formatBase32:
+			return []byte(qrEncoding.EncodeToString(b)), nil
+		}
+		return b, nil
+	case formatGFCJSON:
+		var sigType int
+		switch ki.Type {
+		case types.KTSecp256k1:
+			sigType = 1
+		case types.KTBLS:
+			sigType = 2
+		default:
+			return nil, xerrors.Errorf("unsupported key type: %s", ki.Type)
+		}
+		var f gfcKey
+		f.KeyInfo = append(f.KeyInfo, struct {
+			PrivateKey []byte
+			SigType    int
+		}{PrivateKey: ki.PrivateKey, SigType: sigType})
+		return json.Marshal(&f)
+	case formatSecpHex:
+		if ki.Type != types.KTSecp256k1 {
+			return nil, xerrors.Errorf("%s only supports secp256k1 keys, got %s", format, ki.Type)
+		}
+		return []byte(hex.EncodeToString(ki.PrivateKey)), nil
+	case formatKeyfile:
+		pass, err := password()
+		if err != nil {
+			return nil, err
+		}
+		kf, err := encryptKeyfile(addr, ki, pass)
+		if err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(kf, "", "  ")
+	}
+	return nil, fmt.Errorf("unrecognized format: %s", format)
+}
+
+// decodeKey 按格式解析私钥, keyfile 格式需要口令
+func decodeKey(data []byte, format string, password func() (string, error)) (*types.KeyInfo, error) {
+	var ki types.KeyInfo
+	switch format {
+	case formatHexLotus:
+		b, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &ki); err != nil {
+			return nil, err
+		}
+	case formatJSONLotus:
+		if err := json.Unmarshal(data, &ki); err != nil {
+			return nil, err
+		}
+	case formatBase32:
+		// 扫码得到的内容可能换行或转成小写
+		s := strings.ToUpper(strings.Join(strings.Fields(string(data)), ""))
+		b, err := qrEncoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &ki); err != nil {
+			return nil, err
+		}
+	case formatGFCJSON:
+		var f gfcKey
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, xerrors.Errorf("failed to parse go-filecoin key: %s", err)
+		}
+		if len(f.KeyInfo) == 0 {
+			return nil, xerrors.New("go-filecoin key file contains no keys")
+		}
+
+		gk := f.KeyInfo[0]
+		ki.PrivateKey = gk.PrivateKey
+		switch gk.SigType {
+		case 1:
+			ki.Type = types.KTSecp256k1
+		case 2:
+			ki.Type = types.KTBLS
+		default:
+			return nil, fmt.Errorf("unrecognized key type: %d", gk.SigType)
+		}
+	case formatSecpHex:
+		pk, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+		if err != nil {
+			return nil, err
+		}
+		if len(pk) != 32 {
+			return nil, xerrors.Errorf("secp256k1 private key must be 32 bytes, got %d", len(pk))
+		}
+		ki = types.KeyInfo{Type: types.KTSecp256k1, PrivateKey: pk}
+	case formatKeyfile:
+		var kf keyfile
+		if err := json.Unmarshal(data, &kf); err != nil {
+			return nil, xerrors.Errorf("decoding keyfile: %w", err)
+		}
+		pass, err := password()
+		if err != nil {
+			return nil, err
+		}
+		return kf.decrypt(pass)
+	default:
+		return nil, fmt.Errorf("unrecognized format: %s", format)
+	}
+	return &ki, nil
+}
+
+// keyfile web3 v3 格式的私钥文件: scrypt派生密钥, AES-128-CTR加密私钥, keccak256校验口令.
+// 地址为Filecoin地址, 另外记录私钥类型, 没有类型的按secp256k1处理
+type keyfile struct {
+	Version int             `json:"version"`
+	ID      string          `json:"id"`
+	Address string          `json:"address,omitempty"`
+	KeyType types.KeyType   `json:"keytype,omitempty"`
+	Crypto  keyfileCryptoV3 `json:"crypto"`
+}
+
+type keyfileCryptoV3 struct {
+	Cipher       string `json:"cipher"`
+	CipherText   string `json:"ciphertext"`
+	CipherParams struct {
+		IV string `json:"iv"`
+	} `json:"cipherparams"`
+	KDF       string `json:"kdf"`
+	KDFParams struct {
+		DKLen int    `json:"dklen"`
+		N     int    `json:"n"`
+		R     int    `json:"r"`
+		P     int    `json:"p"`
+		Salt  string `json:"salt"`
+	} `json:"kdfparams"`
+	MAC string `json:"mac"`
+}
+
+func encryptKeyfile(addr address.Address, ki *types.KeyInfo, pass string) (*keyfile, error) {
+	kf := &keyfile{
+		Version: 3,
+		ID:      uuid.New().String(),
+		Address: addr.String(),
+		KeyType: ki.Type,
+	}
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	c := &kf.Crypto
+	c.KDF = "scrypt"
+	c.KDFParams.DKLen = 32
+	c.KDFParams.N = scryptN
+	c.KDFParams.R = scryptR
+	c.KDFParams.P = scryptP
+	c.KDFParams.Salt = hex.EncodeToString(salt)
+	dk, err := scrypt.Key([]byte(pass), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	ct, err := aesCTR(dk[:16], iv, ki.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	c.Cipher = "aes-128-ctr"
+	c.CipherText = hex.EncodeToString(ct)
+	c.CipherParams.IV = hex.EncodeToString(iv)
+	c.MAC = hex.EncodeToString(keccak256(dk[16:32], ct))
+	return kf, nil
+}
+
+func (kf *keyfile) decrypt(pass string) (*types.KeyInfo, error) {
+	c := &kf.Crypto
+	if kf.Version != 3 {
+		return nil, xerrors.Errorf("unsupported keyfile version %d", kf.Version)
+	}
+	if c.KDF != "scrypt" || c.Cipher != "aes-128-ctr" {
+		return nil, xerrors.Errorf("unsupported keyfile kdf %s or cipher %s", c.KDF, c.Cipher)
+	}
+	if c.KDFParams.DKLen < 32 {
+		return nil, xerrors.Errorf("keyfile dklen %d is too short", c.KDFParams.DKLen)
+	}
+	salt, err := hex.DecodeString(c.KDFParams.Salt)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding salt: %w", err)
+	}
+	iv, err := hex.DecodeString(c.CipherParams.IV)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding iv: %w", err)
+	}
+	ct, err := hex.DecodeString(c.CipherText)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding ciphertext: %w", err)
+	}
+	mac, err := hex.DecodeString(c.MAC)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding mac: %w", err)
+	}
+
+	dk, err := scrypt.Key([]byte(pass), salt, c.KDFParams.N, c.KDFParams.R, c.KDFParams.P, c.KDFParams.DKLen)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(keccak256(dk[16:32], ct), mac) != 1 {
+		return nil, xerrors.New("wrong password or corrupted keyfile")
+	}
+	pk, err := aesCTR(dk[:16], iv, ct)
+	if err != nil {
+		return nil, err
+	}
+	kt := kf.KeyType
+	if kt == "" {
+		kt = types.KTSecp256k1
+	}
+	ki := &types.KeyInfo{Type: kt, PrivateKey: pk}
+
+	// 文件记录了地址时检查解密出的私钥是否对应该地址, 避免导入错误的私钥或类型
+	if kf.Address != "" {
+		want, err := address.NewFromString(kf.Address)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing keyfile address: %w", err)
+		}
+		k, err := wallet.NewKey(*ki)
+		if err != nil {
+			return nil, xerrors.Errorf("deriving keyfile address: %w", err)
+		}
+		if k.Address != want {
+			return nil, xerrors.Errorf("keyfile is for %s but the decrypted %s key belongs to %s", want, kt, k.Address)
+		}
+	}
+	return ki, nil
+}
+
+func aesCTR(key, iv, in []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, xerrors.Errorf("invalid iv length %d", len(iv))
+	}
+	out := make([]byte, len(in))
+	cipher.NewCTR(block, iv).XORKeyStream(out, in)
+	return out, nil
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d) // nolint
+	}
+	return h.Sum(nil)
+}
+
+// readKeyPassword 导入keyfile时读取口令
+func readKeyPassword() (string, error) {
+	return readPassphrase("Keyfile password: ")
+}
+
+// readNewKeyPassword 导出keyfile时设置口令
+func readNewKeyPassword() (string, error) {
+	return readNewPassphrase("New keyfile password: ")
+}
+
+// formatUsage 列出支持的格式
+func formatUsage() string {
+	return strings.Join(keyFormats, ", ")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFormats(t *testing.T) {
+	oldN := scryptN
+	scryptN = 1 << 10
+	t.Cleanup(func() { scryptN = oldN })
+	pk, err := hex.DecodeString("7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d")
+	require.NoError(t, err)
+	ki := &types.KeyInfo{Type: types.KTSecp256k1, PrivateKey: pk}
+	key, err := wallet.NewKey(*ki)
+	require.NoError(t, err)
+	addr := key.Address
+	password := func() (string, error) { return "testpassword", nil }
+
+	for _, format := range keyFormats {
+		b, err := encodeKey(addr, ki, format, password)
+		require.NoError(t, err, format)
+		got, err := decodeKey(b, format, password)
+		require.NoError(t, err, format)
+		require.Equal(t, ki, got, format)
+	}
+
+	b, err := encodeKey(addr, ki, formatBase32, password)
+	require.NoError(t, err)
+	require.Regexp(t, "^[A-Z2-7]+$", string(b))
+
+	_, err = encodeKey(addr, &types.KeyInfo{Type: types.KTBLS, PrivateKey: pk}, formatSecpHex, password)
+	require.Error(t, err)
+
+	b, err = encodeKey(addr, ki, formatKeyfile, password)
+	require.NoError(t, err)
+	_, err = decodeKey(b, formatKeyfile, func() (string, error) { return "wrong", nil })
+	require.EqualError(t, err, "wrong password or corrupted keyfile")
+
+	// 文件中的地址与私钥不一致
+	other, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	b, err = encodeKey(other, ki, formatKeyfile, password)
+	require.NoError(t, err)
+	_, err = decodeKey(b, formatKeyfile, password)
+	require.Error(t, err)
+}
+
+func TestWeb3Keyfile(t *testing.T) {
+	// Web3 Secret Storage 规范中的scrypt测试数据
+	var kf keyfile
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "crypto": {
+    "cipher": "aes-128-ctr",
+    "cipherparams": {"iv": "83dbcc02d8ccb40e466191a123791e0e"},
+    "ciphertext": "d172bf743a674da9cdad04534d56926ef8358534d458fffccd4e6ad2fbde479c",
+    "kdf": "scrypt",
+    "kdfparams": {"dklen": 32, "n": 262144, "p": 8, "r": 1, "salt": "ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"},
+    "mac": "2103ac29920d71da29f15d75b4a16dbe95cfd7ff8faea1056c33131d846e3097"
+  },
+  "id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+  "version": 3
+}`), &kf))
+	ki, err := kf.decrypt("testpassword")
+	require.NoError(t, err)
+	require.Equal(t, types.KTSecp256k1, ki.Type)
+	require.Equal(t, "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d", hex.EncodeToString(ki.PrivateKey))
+}
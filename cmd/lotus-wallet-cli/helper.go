@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	ufcli "github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
@@ -77,3 +78,62 @@ func (a *AppFmt) Printf(fmtstr string, args ...interface{}) {
 func (a *AppFmt) Scan(args ...interface{}) (int, error) {
 	return fmt.Fscan(a.Stdin, args...)
 }
+
+// readLine 从标准输入读取一行. 逐字节读取, 不多读后续需要的输入
+func readLine() (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
+// confirm 打印提示并等待输入, 只有输入 y 或 yes 时返回true
+func confirm(prompt string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", prompt)
+	line, err := readLine()
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+func yesFlag() ufcli.Flag {
+	return &ufcli.BoolFlag{
+		Name:  "yes",
+		Usage: "sign without asking for confirmation",
+	}
+}
+
+// confirmSign 展示待签名的内容, 没有 --yes 时要求确认
+func confirmSign(cctx *ufcli.Context, summary []string) error {
+	fmt.Fprintln(os.Stderr, strings.Join(summary, "\n"))
+	if cctx.Bool("yes") {
+		return nil
+	}
+	ok, err := confirm("Sign this message?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return xerrors.New("signing aborted")
+	}
+	return nil
+}
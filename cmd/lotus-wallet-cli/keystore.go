@@ -0,0 +1,333 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/xerrors"
+)
+
+// 钱包目录下的加密参数文件
+const encryptionFile = "encryption.json"
+
+// 加密后的key在keystore中的名字前缀, 没有该前缀的key是未加密的
+const encryptedPrefix = "encrypted-"
+
+// scrypt参数, 在普通机器上派生一次约需1秒
+var (
+	scryptN = 1 << 18
+	scryptR = 8
+	scryptP = 1
+)
+
+// encryptionParams 数据密钥随机生成, 用口令经scrypt派生的密钥加密后保存. 修改口令只需重新加密数据密钥
+type encryptionParams struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	// nonce + AES-GCM加密的数据密钥
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+func newEncryptionParams(passphrase string, dataKey []byte) (*encryptionParams, error) {
+	ep := &encryptionParams{Version: 1, KDF: "scrypt", Salt: make([]byte, 32), N: scryptN, R: scryptR, P: scryptP}
+	if _, err := io.ReadFull(rand.Reader, ep.Salt); err != nil {
+		return nil, err
+	}
+	kek, err := ep.derive(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if ep.WrappedKey, err = seal(kek, dataKey, []byte(encryptionFile)); err != nil {
+		return nil, err
+	}
+	return ep, nil
+}
+
+func (ep *encryptionParams) derive(passphrase string) ([]byte, error) {
+	if ep.KDF != "scrypt" {
+		return nil, xerrors.Errorf("unsupported kdf: %s", ep.KDF)
+	}
+	return scrypt.Key([]byte(passphrase), ep.Salt, ep.N, ep.R, ep.P, 32)
+}
+
+// unwrap 用口令解密数据密钥
+func (ep *encryptionParams) unwrap(passphrase string) ([]byte, error) {
+	kek, err := ep.derive(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := open(kek, ep.WrappedKey, []byte(encryptionFile))
+	if err != nil {
+		return nil, xerrors.New("wrong passphrase")
+	}
+	return key, nil
+}
+
+// loadEncryptionParams 文件不存在时返回nil
+func loadEncryptionParams(path string) (*encryptionParams, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ep encryptionParams
+	if err := json.Unmarshal(b, &ep); err != nil {
+		return nil, xerrors.Errorf("decoding %s: %w", path, err)
+	}
+	return &ep, nil
+}
+
+// saveEncryptionParams 先写临时文件再改名, 避免中断后丢失数据密钥
+func saveEncryptionParams(path string, ep *encryptionParams) error {
+	b, err := json.MarshalIndent(ep, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newDataKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// seal AES-256-GCM加密, 返回 nonce + 密文. aad 绑定密文的用途, 防止密文被挪作他用
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, xerrors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedKeyStore 在repo的keystore上加密保存 KeyInfo, 第一次读写key时才要求输入口令
+type encryptedKeyStore struct {
+	inner types.KeyStore
+	// 加密参数文件的路径
+	path   string
+	params *encryptionParams
+	// 返回解密用的口令
+	passphrase func() (string, error)
+	key        []byte
+}
+
+var _ types.KeyStore = (*encryptedKeyStore)(nil)
+
+func (ks *encryptedKeyStore) unlock() error {
+	if ks.key != nil {
+		return nil
+	}
+	pass, err := ks.passphrase()
+	if err != nil {
+		return err
+	}
+	key, err := ks.params.unwrap(pass)
+	if err != nil {
+		return err
+	}
+	ks.key = key
+	return nil
+}
+
+func (ks *encryptedKeyStore) List() ([]string, error) {
+	names, err := ks.inner.List()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		if strings.HasPrefix(name, encryptedPrefix) {
+			out = append(out, strings.TrimPrefix(name, encryptedPrefix))
+		}
+	}
+	return out, nil
+}
+
+func (ks *encryptedKeyStore) Get(name string) (types.KeyInfo, error) {
+	enc, err := ks.inner.Get(encryptedPrefix + name)
+	if err != nil {
+		return types.KeyInfo{}, err
+	}
+	if err := ks.unlock(); err != nil {
+		return types.KeyInfo{}, err
+	}
+	b, err := open(ks.key, enc.PrivateKey, []byte(name))
+	if err != nil {
+		return types.KeyInfo{}, xerrors.Errorf("decrypting key %s: %w", name, err)
+	}
+	var ki types.KeyInfo
+	if err := json.Unmarshal(b, &ki); err != nil {
+		return types.KeyInfo{}, xerrors.Errorf("decoding key %s: %w", name, err)
+	}
+	return ki, nil
+}
+
+func (ks *encryptedKeyStore) Put(name string, ki types.KeyInfo) error {
+	if err := ks.unlock(); err != nil {
+		return err
+	}
+	enc, err := encryptKeyInfo(ks.key, name, ki)
+	if err != nil {
+		return err
+	}
+	return ks.inner.Put(encryptedPrefix+name, enc)
+}
+
+func (ks *encryptedKeyStore) Delete(name string) error {
+	return ks.inner.Delete(encryptedPrefix + name)
+}
+
+// changePassphrase 用新口令重新加密数据密钥, key本身不需要重新加密
+func (ks *encryptedKeyStore) changePassphrase(passphrase string) error {
+	if err := ks.unlock(); err != nil {
+		return err
+	}
+	ep, err := newEncryptionParams(passphrase, ks.key)
+	if err != nil {
+		return err
+	}
+	if err := saveEncryptionParams(ks.path, ep); err != nil {
+		return xerrors.Errorf("saving encryption params: %w", err)
+	}
+	ks.params = ep
+	return nil
+}
+
+// encryptKeyInfo 加密后的 KeyInfo 只用 PrivateKey 字段保存密文, 以key的名字作为aad
+func encryptKeyInfo(key []byte, name string, ki types.KeyInfo) (types.KeyInfo, error) {
+	b, err := json.Marshal(ki)
+	if err != nil {
+		return types.KeyInfo{}, err
+	}
+	data, err := seal(key, b, []byte(name))
+	if err != nil {
+		return types.KeyInfo{}, xerrors.Errorf("encrypting key %s: %w", name, err)
+	}
+	return types.KeyInfo{Type: "encrypted", PrivateKey: data}, nil
+}
+
+// plaintextKeys 返回keystore中未加密的key
+func plaintextKeys(ks types.KeyStore) ([]string, error) {
+	names, err := ks.List()
+	if err != nil {
+		return nil, err
+	}
+	var plain []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, encryptedPrefix) {
+			plain = append(plain, name)
+		}
+	}
+	return plain, nil
+}
+
+// migrateKeyStore 加密所有未加密的key. 先写入加密的key再删除原key, 中断后可以重新执行
+func migrateKeyStore(ks types.KeyStore, key []byte) (int, error) {
+	plain, err := plaintextKeys(ks)
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range plain {
+		ki, err := ks.Get(name)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := ks.Get(encryptedPrefix + name); xerrors.Is(err, types.ErrKeyInfoNotFound) {
+			enc, err := encryptKeyInfo(key, name, ki)
+			if err != nil {
+				return 0, err
+			}
+			if err := ks.Put(encryptedPrefix+name, enc); err != nil {
+				return 0, err
+			}
+		} else if err != nil {
+			return 0, err
+		}
+		if err := ks.Delete(name); err != nil {
+			return 0, err
+		}
+	}
+	return len(plain), nil
+}
+
+func encryptionParamsPath(repoPath string) string {
+	return filepath.Join(repoPath, encryptionFile)
+}
+
+// readPassphrase 从终端读取口令且不回显; stdin不是终端时读取一行
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		b, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	}
+	return readLine()
+}
+
+// readNewPassphrase 要求输入两次新口令
+func readNewPassphrase(prompt string) (string, error) {
+	pass, err := readPassphrase(prompt)
+	if err != nil {
+		return "", err
+	}
+	if len(pass) < 8 {
+		return "", xerrors.New("passphrase must be at least 8 characters")
+	}
+	again, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass != again {
+		return "", xerrors.New("passphrases do not match")
+	}
+	return pass, nil
+}
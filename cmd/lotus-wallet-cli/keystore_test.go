@@ -0,0 +1,103 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+type memKeyStore map[string]types.KeyInfo
+
+func (m memKeyStore) List() ([]string, error) {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m memKeyStore) Get(name string) (types.KeyInfo, error) {
+	ki, ok := m[name]
+	if !ok {
+		return types.KeyInfo{}, xerrors.Errorf("getting key '%s': %w", name, types.ErrKeyInfoNotFound)
+	}
+	return ki, nil
+}
+
+func (m memKeyStore) Put(name string, ki types.KeyInfo) error {
+	if _, ok := m[name]; ok {
+		return types.ErrKeyExists
+	}
+	m[name] = ki
+	return nil
+}
+
+func (m memKeyStore) Delete(name string) error {
+	if _, ok := m[name]; !ok {
+		return types.ErrKeyInfoNotFound
+	}
+	delete(m, name)
+	return nil
+}
+
+func TestEncryptedKeyStore(t *testing.T) {
+	oldN := scryptN
+	scryptN = 1 << 10
+	t.Cleanup(func() { scryptN = oldN })
+	path := filepath.Join(t.TempDir(), encryptionFile)
+	inner := memKeyStore{"wallet-f1plain": {Type: types.KTSecp256k1, PrivateKey: []byte("plain")}}
+
+	// 迁移已有的未加密key
+	key, err := newDataKey()
+	require.NoError(t, err)
+	ep, err := newEncryptionParams("old passphrase", key)
+	require.NoError(t, err)
+	require.NoError(t, saveEncryptionParams(path, ep))
+	n, err := migrateKeyStore(inner, key)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	plain, err := plaintextKeys(inner)
+	require.NoError(t, err)
+	require.Empty(t, plain)
+	require.NotEqual(t, []byte("plain"), inner[encryptedPrefix+"wallet-f1plain"].PrivateKey)
+
+	pass := "old passphrase"
+	open := func() *encryptedKeyStore {
+		ep, err := loadEncryptionParams(path)
+		require.NoError(t, err)
+		return &encryptedKeyStore{inner: inner, path: path, params: ep, passphrase: func() (string, error) { return pass, nil }}
+	}
+
+	ks := open()
+	names, err := ks.List()
+	require.NoError(t, err)
+	require.Equal(t, []string{"wallet-f1plain"}, names)
+	ki, err := ks.Get("wallet-f1plain")
+	require.NoError(t, err)
+	require.Equal(t, []byte("plain"), ki.PrivateKey)
+	require.NoError(t, ks.Put("wallet-f1new", types.KeyInfo{Type: types.KTBLS, PrivateKey: []byte("new")}))
+	_, err = ks.Get("wallet-f1missing")
+	require.True(t, xerrors.Is(err, types.ErrKeyInfoNotFound))
+
+	// 密文不能换到别的名字下使用
+	inner[encryptedPrefix+"wallet-f1swapped"] = inner[encryptedPrefix+"wallet-f1new"]
+	_, err = ks.Get("wallet-f1swapped")
+	require.Error(t, err)
+	delete(inner, encryptedPrefix+"wallet-f1swapped")
+
+	require.NoError(t, ks.changePassphrase("new passphrase"))
+
+	_, err = open().Get("wallet-f1new")
+	require.EqualError(t, err, "wrong passphrase")
+
+	pass = "new passphrase"
+	ki, err = open().Get("wallet-f1new")
+	require.NoError(t, err)
+	require.Equal(t, types.KTBLS, ki.Type)
+	require.Equal(t, []byte("new"), ki.PrivateKey)
+}
@@ -1,23 +1,19 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"github.com/filecoin-project/go-address"
-	"github.com/filecoin-project/go-state-types/abi"
-	"github.com/filecoin-project/lotus/chain/actors"
-	multisig0 "github.com/filecoin-project/lotus/chain/actors/builtin/multisig"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/guoxiaopeng875/lotus-adapter/envelope"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh/terminal"
 	"golang.org/x/xerrors"
 	"io/ioutil"
 	"os"
-	"strconv"
-	"strings"
+	"path/filepath"
 	"sync"
 
 	"github.com/filecoin-project/lotus/api"
@@ -41,11 +37,19 @@ func main() {
 
 	local := []*cli.Command{
 		walletNew,
+		walletRestore,
 		walletList,
 		walletDelete,
 		walletImport,
 		walletExport,
 		walletSign,
+		walletEncrypt,
+		walletChangePassphrase,
+		sendCmd,
+		signEnvelopeCmd,
+		msigCmd,
+		auditCmd,
+		// 兼容旧的用法, 与 msig propose/approve 相同
 		msigProposeCmd,
 		msigApproveCmd,
 	}
@@ -80,7 +84,33 @@ func NewWalletAPI(cctx *cli.Context) error {
 	return err
 }
 
+// newWalletAPI 打开钱包, 签名都记录到审计日志, 钱包目录中有策略文件时签名前检查策略
 func newWalletAPI(cctx *cli.Context) (api.WalletAPI, error) {
+	lr, err := openRepo(cctx)
+	if err != nil {
+		return nil, err
+	}
+	ks, err := openKeyStore(lr)
+	if err != nil {
+		return nil, err
+	}
+	lw, err := wallet.NewWallet(ks)
+	if err != nil {
+		return nil, err
+	}
+	var w api.WalletAPI = &auditWallet{WalletAPI: lw, path: filepath.Join(lr.Path(), auditFile)}
+	policy, err := loadPolicy(filepath.Join(lr.Path(), policyFile))
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return w, nil
+	}
+	return &policyWallet{WalletAPI: w, policy: policy}, nil
+}
+
+// openRepo 锁定钱包目录, 不存在时初始化
+func openRepo(cctx *cli.Context) (repo.LockedRepo, error) {
 	repoPath := cctx.String(FlagWalletRepo)
 	r, err := repo.NewFS(repoPath)
 	if err != nil {
@@ -97,23 +127,161 @@ func newWalletAPI(cctx *cli.Context) (api.WalletAPI, error) {
 		}
 	}
 
-	lr, err := r.Lock(repo.Wallet)
+	return r.Lock(repo.Wallet)
+}
+
+// openKeyStore 打开加密的keystore, 有未加密的key时拒绝打开, 需要先执行 encrypt. 新的钱包目录要求先设置口令
+func openKeyStore(lr repo.LockedRepo) (*encryptedKeyStore, error) {
+	inner, err := lr.KeyStore()
 	if err != nil {
 		return nil, err
 	}
 
-	ks, err := lr.KeyStore()
+	plain, err := plaintextKeys(inner)
 	if err != nil {
 		return nil, err
 	}
+	if len(plain) > 0 {
+		return nil, xerrors.Errorf("wallet repo %s contains %d unencrypted keys, run `lotus-wallet encrypt` to migrate it", lr.Path(), len(plain))
+	}
 
-	return wallet.NewWallet(ks)
+	ks := &encryptedKeyStore{
+		inner: inner,
+		path:  encryptionParamsPath(lr.Path()),
+		passphrase: func() (string, error) {
+			return readPassphrase("Wallet passphrase: ")
+		},
+	}
+	if ks.params, err = loadEncryptionParams(ks.path); err != nil {
+		return nil, err
+	}
+	if ks.params == nil {
+		fmt.Fprintln(os.Stderr, "Initializing encrypted wallet repo")
+		pass, err := readNewPassphrase("New wallet passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if ks.key, err = newDataKey(); err != nil {
+			return nil, err
+		}
+		if ks.params, err = newEncryptionParams(pass, ks.key); err != nil {
+			return nil, err
+		}
+		if err := saveEncryptionParams(ks.path, ks.params); err != nil {
+			return nil, xerrors.Errorf("saving encryption params: %w", err)
+		}
+	}
+	return ks, nil
+}
+
+var walletEncrypt = &cli.Command{
+	Name:  "encrypt",
+	Usage: "Encrypt the keys of an unencrypted wallet repo with a passphrase",
+	Action: func(cctx *cli.Context) error {
+		lr, err := openRepo(cctx)
+		if err != nil {
+			return err
+		}
+		ks, err := lr.KeyStore()
+		if err != nil {
+			return err
+		}
+		plain, err := plaintextKeys(ks)
+		if err != nil {
+			return err
+		}
+
+		path := encryptionParamsPath(lr.Path())
+		ep, err := loadEncryptionParams(path)
+		if err != nil {
+			return err
+		}
+		if ep != nil && len(plain) == 0 {
+			fmt.Println("wallet repo is already encrypted")
+			return nil
+		}
+
+		var key []byte
+		if ep != nil {
+			// 上次迁移中断, 继续使用已保存的数据密钥
+			pass, err := readPassphrase("Wallet passphrase: ")
+			if err != nil {
+				return err
+			}
+			if key, err = ep.unwrap(pass); err != nil {
+				return err
+			}
+		} else {
+			pass, err := readNewPassphrase("New wallet passphrase: ")
+			if err != nil {
+				return err
+			}
+			if key, err = newDataKey(); err != nil {
+				return err
+			}
+			if ep, err = newEncryptionParams(pass, key); err != nil {
+				return err
+			}
+			// 先保存数据密钥再加密key
+			if err := saveEncryptionParams(path, ep); err != nil {
+				return xerrors.Errorf("saving encryption params: %w", err)
+			}
+		}
+
+		n, err := migrateKeyStore(ks, key)
+		if err != nil {
+			return xerrors.Errorf("encrypting keys: %w", err)
+		}
+		fmt.Printf("encrypted %d keys\n", n)
+		return nil
+	},
+}
+
+var walletChangePassphrase = &cli.Command{
+	Name:  "change-passphrase",
+	Usage: "Change the passphrase of the wallet repo",
+	Action: func(cctx *cli.Context) error {
+		lr, err := openRepo(cctx)
+		if err != nil {
+			return err
+		}
+		ks, err := openKeyStore(lr)
+		if err != nil {
+			return err
+		}
+		ks.passphrase = func() (string, error) {
+			return readPassphrase("Current passphrase: ")
+		}
+		if err := ks.unlock(); err != nil {
+			return err
+		}
+		pass, err := readNewPassphrase("New wallet passphrase: ")
+		if err != nil {
+			return err
+		}
+		if err := ks.changePassphrase(pass); err != nil {
+			return err
+		}
+		fmt.Println("passphrase changed")
+		return nil
+	},
 }
 
 var walletNew = &cli.Command{
 	Name:      "new",
 	Usage:     "Generate a new key of the given type",
 	ArgsUsage: "[bls|secp256k1 (default secp256k1)]",
+	Flags: append(mnemonicFlags(),
+		&cli.BoolFlag{
+			Name:  "mnemonic",
+			Usage: "generate a BIP-39 mnemonic and derive secp256k1 keys along " + filecoinPath + "/i from it",
+		},
+		&cli.IntFlag{
+			Name:  "words",
+			Usage: "number of mnemonic words, 12 or 24",
+			Value: 24,
+		},
+	),
 	Action: func(cctx *cli.Context) error {
 		api, err := newWalletAPI(cctx)
 		if err != nil {
@@ -125,6 +293,13 @@ var walletNew = &cli.Command{
 			t = "secp256k1"
 		}
 
+		if cctx.Bool("mnemonic") {
+			if types.KeyType(t) != types.KTSecp256k1 {
+				return xerrors.New("mnemonic keys can only be secp256k1")
+			}
+			return newMnemonic(cctx, api)
+		}
+
 		nk, err := api.WalletNew(cctx.Context, types.KeyType(t))
 		if err != nil {
 			return err
@@ -177,7 +352,30 @@ var walletExport = &cli.Command{
 	Name:      "export",
 	Usage:     "export keys",
 	ArgsUsage: "[address]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "specify output format for key: " + formatUsage(),
+			Value: formatHexLotus,
+		},
+		&cli.StringFlag{
+			Name:  "shamir",
+			Usage: "split the key into n shares of which any k restore it, given as k/n",
+		},
+		&cli.StringFlag{
+			Name:  "shamir-dir",
+			Usage: "write each share to a separate file in this directory instead of printing them",
+		},
+	},
 	Action: func(cctx *cli.Context) error {
+		// 分片固定使用 json-lotus 格式, 不支持的组合直接报错, 避免误以为已按要求备份
+		if cctx.IsSet("shamir-dir") && !cctx.IsSet("shamir") {
+			return ShowHelp(cctx, xerrors.New("--shamir-dir requires --shamir"))
+		}
+		if cctx.IsSet("format") && cctx.IsSet("shamir") {
+			return ShowHelp(cctx, xerrors.New("--format cannot be used with --shamir, shares always contain the json-lotus key"))
+		}
+
 		api, err := newWalletAPI(cctx)
 		if err != nil {
 			return err
@@ -197,12 +395,16 @@ var walletExport = &cli.Command{
 			return err
 		}
 
-		b, err := json.Marshal(ki)
+		if cctx.IsSet("shamir") {
+			return exportKeyShares(cctx, addr, ki)
+		}
+
+		b, err := encodeKey(addr, ki, cctx.String("format"), readNewKeyPassword)
 		if err != nil {
 			return err
 		}
 
-		fmt.Println(hex.EncodeToString(b))
+		fmt.Println(string(b))
 		return nil
 	},
 }
@@ -214,8 +416,12 @@ var walletImport = &cli.Command{
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:  "format",
-			Usage: "specify input format for key",
-			Value: "hex-lotus",
+			Usage: "specify input format for key: " + formatUsage(),
+			Value: formatHexLotus,
+		},
+		&cli.BoolFlag{
+			Name:  "shamir",
+			Usage: "restore the key from shares written by export --shamir, given as files or entered one by one",
 		},
 	},
 	Action: func(cctx *cli.Context) error {
@@ -224,65 +430,55 @@ var walletImport = &cli.Command{
 			return err
 		}
 
-		var inpdata []byte
-		if !cctx.Args().Present() || cctx.Args().First() == "-" {
-			reader := bufio.NewReader(os.Stdin)
-			fmt.Print("Enter private key: ")
-			indata, err := reader.ReadBytes('\n')
+		if cctx.Bool("shamir") {
+			ki, err := readKeyShares(cctx)
 			if err != nil {
 				return err
 			}
-			inpdata = indata
-
-		} else {
-			fdata, err := ioutil.ReadFile(cctx.Args().First())
+			addr, err := api.WalletImport(cctx.Context, ki)
 			if err != nil {
 				return err
 			}
-			inpdata = fdata
+			fmt.Printf("imported key %s successfully!\n", addr)
+			return nil
 		}
 
-		var ki types.KeyInfo
-		switch cctx.String("format") {
-		case "hex-lotus":
-			data, err := hex.DecodeString(strings.TrimSpace(string(inpdata)))
-			if err != nil {
-				return err
-			}
-
-			if err := json.Unmarshal(data, &ki); err != nil {
-				return err
-			}
-		case "json-lotus":
-			if err := json.Unmarshal(inpdata, &ki); err != nil {
-				return err
-			}
-		case "gfc-json":
-			var f struct {
-				KeyInfo []struct {
-					PrivateKey []byte
-					SigType    int
+		var inpdata []byte
+		if !cctx.Args().Present() || cctx.Args().First() == "-" {
+			switch format := cctx.String("format"); format {
+			case formatHexLotus, formatSecpHex:
+				fmt.Fprint(os.Stderr, "Enter private key: ")
+				line, err := readLine()
+				if err != nil {
+					return err
+				}
+				inpdata = []byte(line)
+			default:
+				// 其他格式可能有多行, 读到EOF为止. keyfile 的口令也从标准输入读取, 不是终端时无法再输入
+				if format == formatKeyfile && !terminal.IsTerminal(int(os.Stdin.Fd())) {
+					return xerrors.New("pass the keyfile path as an argument, stdin is needed for the password")
 				}
+				fmt.Fprint(os.Stderr, "Enter private key, finish with Ctrl-D: ")
+				indata, err := ioutil.ReadAll(os.Stdin)
+				if err != nil {
+					return err
+				}
+				inpdata = indata
 			}
-			if err := json.Unmarshal(inpdata, &f); err != nil {
-				return xerrors.Errorf("failed to parse go-filecoin key: %s", err)
+		} else {
+			fdata, err := ioutil.ReadFile(cctx.Args().First())
+			if err != nil {
+				return err
 			}
+			inpdata = fdata
+		}
 
-			gk := f.KeyInfo[0]
-			ki.PrivateKey = gk.PrivateKey
-			switch gk.SigType {
-			case 1:
-				ki.Type = types.KTSecp256k1
-			case 2:
-				ki.Type = types.KTBLS
-			default:
-				return fmt.Errorf("unrecognized key type: %d", gk.SigType)
-			}
-		default:
-			return fmt.Errorf("unrecognized format: %s", cctx.String("format"))
+		ki, err := decodeKey(inpdata, cctx.String("format"), readKeyPassword)
+		if err != nil {
+			return err
 		}
 
-		addr, err := api.WalletImport(cctx.Context, &ki)
+		addr, err := api.WalletImport(cctx.Context, ki)
 		if err != nil {
 			return err
 		}
@@ -296,6 +492,9 @@ var walletSign = &cli.Command{
 	Name:      "sign",
 	Usage:     "sign a message",
 	ArgsUsage: "<signing address> <hexMessage>",
+	Flags: []cli.Flag{
+		yesFlag(),
+	},
 	Action: func(cctx *cli.Context) error {
 		walletAPI, err := newWalletAPI(cctx)
 		if err != nil {
@@ -318,6 +517,15 @@ var walletSign = &cli.Command{
 			return err
 		}
 
+		summary := []string{fmt.Sprintf("Raw data (%d bytes): %s", len(msg), cctx.Args().Get(1))}
+		if m, err := types.DecodeMessage(msg); err == nil {
+			summary = append(summary, "Data is a serialized message, note that chain messages are signed over their CID:")
+			summary = append(summary, envelope.Describe(m, nil)...)
+		}
+		if err := confirmSign(cctx, summary); err != nil {
+			return err
+		}
+
 		sig, err := walletAPI.WalletSign(cctx.Context, addr, msg, api.MsgMeta{
 			Type: api.MTUnknown,
 		})
@@ -356,131 +564,10 @@ var walletDelete = &cli.Command{
 	},
 }
 
-var msigProposeCmd = &cli.Command{
-	Name:      "propose",
-	Usage:     "Propose a multisig transaction",
-	ArgsUsage: "[multisigAddress destinationAddress value <methodId methodParams> (optional)]",
-	Flags: []cli.Flag{
-		&cli.StringFlag{
-			Name:  "from",
-			Usage: "account to send the propose message from",
-		},
-		&cli.StringFlag{
-			Name:  "gas-premium",
-			Usage: "specify gas price to use in AttoFIL",
-			Value: "0",
-		},
-		&cli.StringFlag{
-			Name:  "gas-feecap",
-			Usage: "specify gas fee cap to use in AttoFIL",
-			Value: "0",
-		},
-		&cli.Int64Flag{
-			Name:  "gas-limit",
-			Usage: "specify gas limit",
-			Value: 0,
-		},
-		&cli.Int64Flag{
-			Name:  "nonce",
-			Usage: "specify the nonce to use",
-			Value: 0,
-		},
-		&cli.Uint64Flag{
-			Name:  "method",
-			Usage: "specify method to invoke",
-			Value: 0,
-		},
-	},
-	Action: func(cctx *cli.Context) error {
-		walletAPI, err := newWalletAPI(cctx)
-		if err != nil {
-			return err
-		}
-
-		if cctx.Args().Len() < 3 {
-			return ShowHelp(cctx, fmt.Errorf("must pass at least multisig address, destination, and value"))
-		}
-
-		if cctx.Args().Len() > 3 && cctx.Args().Len() != 5 {
-			return ShowHelp(cctx, fmt.Errorf("must either pass three or five arguments"))
-		}
-
-		if !cctx.IsSet("from") {
-			return ShowHelp(cctx, xerrors.New("must specify --from"))
-		}
-
-		msig, err := address.NewFromString(cctx.Args().Get(0))
-		if err != nil {
-			return err
-		}
-
-		dest, err := address.NewFromString(cctx.Args().Get(1))
-		if err != nil {
-			return err
-		}
-
-		value, err := types.ParseFIL(cctx.Args().Get(2))
-		if err != nil {
-			return err
-		}
-
-		var method uint64
-		var params []byte
-		if cctx.Args().Len() == 5 {
-			m, err := strconv.ParseUint(cctx.Args().Get(3), 10, 64)
-			if err != nil {
-				return err
-			}
-			method = m
-
-			p, err := hex.DecodeString(cctx.Args().Get(4))
-			if err != nil {
-				return err
-			}
-			params = p
-		}
-
-		from, err := address.NewFromString(cctx.String("from"))
-		if err != nil {
-			return err
-		}
-
-		m := abi.MethodNum(method)
-
-		msgBuilder := multisig0.Message(actors.Version0, from)
-
-		msg, err := msgBuilder.Propose(msig, dest, types.BigInt(value), m, params)
-
-		if err != nil {
-			return xerrors.Errorf("buildProposeMessage: %w", err)
-		}
-		if err := setGasParamsFromCCtx(cctx, msg); err != nil {
-			return err
-		}
-		msgStr, err := signMsg(cctx.Context, walletAPI, msg)
-		if err != nil {
-			return err
-		}
-		fmt.Println(msgStr)
-		return nil
-	},
-}
-
 func signMsg(ctx context.Context, walletAPI api.WalletAPI, msg *types.Message) (string, error) {
-	mb, err := msg.ToStorageBlock()
-	if err != nil {
-		return "", xerrors.Errorf("serializing message: %w", err)
-	}
-	sig, err := walletAPI.WalletSign(ctx, msg.From, mb.Cid().Bytes(), api.MsgMeta{
-		Type:  api.MTChainMsg,
-		Extra: mb.RawData(),
-	})
+	sm, err := signMessage(ctx, walletAPI, msg)
 	if err != nil {
-		return "", xerrors.Errorf("failed to sign message: %w", err)
-	}
-	sm := &types.SignedMessage{
-		Message:   *msg,
-		Signature: *sig,
+		return "", err
 	}
 	smBytes, err := sm.Serialize()
 	if err != nil {
@@ -489,31 +576,27 @@ func signMsg(ctx context.Context, walletAPI api.WalletAPI, msg *types.Message) (
 	return hex.EncodeToString(smBytes), nil
 }
 
-func setGasParamsFromCCtx(cctx *cli.Context, msg *types.Message) error {
-	gp, err := types.BigFromString(cctx.String("gas-premium"))
+func signMessage(ctx context.Context, walletAPI api.WalletAPI, msg *types.Message) (*types.SignedMessage, error) {
+	mb, err := msg.ToStorageBlock()
 	if err != nil {
-		return fmt.Errorf("failed to parse gas-premium: %w", err)
+		return nil, xerrors.Errorf("serializing message: %w", err)
 	}
-	gfc, err := types.BigFromString(cctx.String("gas-feecap"))
+	sig, err := walletAPI.WalletSign(ctx, msg.From, mb.Cid().Bytes(), api.MsgMeta{
+		Type:  api.MTChainMsg,
+		Extra: mb.RawData(),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to parse gas-feecap: %w", err)
+		return nil, xerrors.Errorf("failed to sign message: %w", err)
 	}
-	msg.GasPremium = gp
-	msg.GasFeeCap = gfc
-	msg.GasLimit = cctx.Int64("gas-limit")
-	msg.Nonce = uint64(cctx.Int64("nonce"))
-	return nil
+	return &types.SignedMessage{
+		Message:   *msg,
+		Signature: *sig,
+	}, nil
 }
 
-var msigApproveCmd = &cli.Command{
-	Name:      "approve",
-	Usage:     "Approve a multisig message",
-	ArgsUsage: "<multisigAddress messageId> [proposerAddress destination value [methodId methodParams]]",
-	Flags: []cli.Flag{
-		&cli.StringFlag{
-			Name:  "from",
-			Usage: "account to send the approve message from",
-		},
+// gasFlags 离线签名时需要手动指定的gas和nonce
+func gasFlags() []cli.Flag {
+	return []cli.Flag{
 		&cli.StringFlag{
 			Name:  "gas-premium",
 			Usage: "specify gas price to use in AttoFIL",
@@ -534,58 +617,21 @@ var msigApproveCmd = &cli.Command{
 			Usage: "specify the nonce to use",
 			Value: 0,
 		},
-		&cli.Uint64Flag{
-			Name:  "method",
-			Usage: "specify method to invoke",
-			Value: 0,
-		},
-	},
-	Action: func(cctx *cli.Context) error {
-		walletAPI, err := newWalletAPI(cctx)
-		if err != nil {
-			return err
-		}
-		if cctx.Args().Len() < 2 {
-			return ShowHelp(cctx, fmt.Errorf("must pass at least multisig address and message ID"))
-		}
-
-		if cctx.Args().Len() > 5 && cctx.Args().Len() != 7 {
-			return ShowHelp(cctx, fmt.Errorf("usage: msig approve <msig addr> <message ID> <proposer address> <desination> <value> [ <method> <params> ]"))
-		}
-
-		if cctx.Args().Len() > 2 && cctx.Args().Len() != 5 {
-			return ShowHelp(cctx, fmt.Errorf("usage: msig approve <msig addr> <message ID> <proposer address> <desination> <value>"))
-		}
-
-		msig, err := address.NewFromString(cctx.Args().Get(0))
-		if err != nil {
-			return err
-		}
-
-		txid, err := strconv.ParseUint(cctx.Args().Get(1), 10, 64)
-		if err != nil {
-			return err
-		}
-
-		from, err := address.NewFromString(cctx.String("from"))
-		if err != nil {
-			return err
-		}
-
-		msgBuilder := multisig0.Message(actors.Version0, from)
+	}
+}
 
-		msg, err := msgBuilder.Approve(msig, txid, nil)
-		if err != nil {
-			return err
-		}
-		if err := setGasParamsFromCCtx(cctx, msg); err != nil {
-			return err
-		}
-		msgStr, err := signMsg(cctx.Context, walletAPI, msg)
-		if err != nil {
-			return err
-		}
-		fmt.Println(msgStr)
-		return nil
-	},
+func setGasParamsFromCCtx(cctx *cli.Context, msg *types.Message) error {
+	gp, err := types.BigFromString(cctx.String("gas-premium"))
+	if err != nil {
+		return fmt.Errorf("failed to parse gas-premium: %w", err)
+	}
+	gfc, err := types.BigFromString(cctx.String("gas-feecap"))
+	if err != nil {
+		return fmt.Errorf("failed to parse gas-feecap: %w", err)
+	}
+	msg.GasPremium = gp
+	msg.GasFeeCap = gfc
+	msg.GasLimit = cctx.Int64("gas-limit")
+	msg.Nonce = uint64(cctx.Int64("nonce"))
+	return nil
 }
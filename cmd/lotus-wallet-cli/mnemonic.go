@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/tyler-smith/go-bip39"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// BIP-44 中 Filecoin 的路径, 最后一级为地址序号
+const filecoinPath = "m/44'/461'/0'/0"
+
+const hardenedOffset = 0x80000000
+
+// parsePath 解析 BIP-32 路径, ' 或 h 结尾的为hardened
+func parsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, xerrors.Errorf("path %s must start with m", path)
+	}
+	var indexes []uint32
+	for _, p := range parts[1:] {
+		var offset uint32
+		if strings.HasSuffix(p, "'") || strings.HasSuffix(p, "h") {
+			offset = hardenedOffset
+			p = p[:len(p)-1]
+		}
+		i, err := strconv.ParseUint(p, 10, 32)
+		if err != nil || i >= hardenedOffset {
+			return nil, xerrors.Errorf("invalid path element %s in %s", p, path)
+		}
+		indexes = append(indexes, uint32(i)+offset)
+	}
+	return indexes, nil
+}
+
+// deriveKey 按 BIP-32 从种子派生secp256k1私钥
+func deriveKey(seed []byte, path []uint32) ([]byte, error) {
+	key, chain := hmacSHA512([]byte("Bitcoin seed"), seed)
+	if !validScalar(key) {
+		return nil, xerrors.New("invalid master key, use another seed")
+	}
+	for _, index := range path {
+		data := make([]byte, 0, 37)
+		if index >= hardenedOffset {
+			data = append(append(data, 0), key...)
+		} else {
+			_, pub := btcec.PrivKeyFromBytes(btcec.S256(), key)
+			data = append(data, pub.SerializeCompressed()...)
+		}
+		data = append(data, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+		il, ir := hmacSHA512(chain, data)
+		if !validScalar(il) {
+			return nil, xerrors.Errorf("invalid child key at index %d, use the next index", index)
+		}
+		k := new(big.Int).SetBytes(il)
+		k.Add(k, new(big.Int).SetBytes(key))
+		k.Mod(k, btcec.S256().N)
+		if k.Sign() == 0 {
+			return nil, xerrors.Errorf("invalid child key at index %d, use the next index", index)
+		}
+		key = make([]byte, 32)
+		k.FillBytes(key)
+		chain = ir
+	}
+	return key, nil
+}
+
+func hmacSHA512(key, data []byte) ([]byte, []byte) {
+	h := hmac.New(sha512.New, key)
+	h.Write(data) // nolint
+	sum := h.Sum(nil)
+	return sum[:32], sum[32:]
+}
+
+func validScalar(b []byte) bool {
+	k := new(big.Int).SetBytes(b)
+	return k.Sign() > 0 && k.Cmp(btcec.S256().N) < 0
+}
+
+// mnemonicKeys 从助记词派生序号 [start, start+count) 的地址的私钥
+func mnemonicKeys(mnemonic, password string, start, count int) ([]*types.KeyInfo, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, password)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid mnemonic: %w", err)
+	}
+	base, err := parsePath(filecoinPath)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*types.KeyInfo, 0, count)
+	for i := start; i < start+count; i++ {
+		pk, err := deriveKey(seed, append(base[:len(base):len(base)], uint32(i)))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &types.KeyInfo{Type: types.KTSecp256k1, PrivateKey: pk})
+	}
+	return keys, nil
+}
+
+func mnemonicPassword(cctx *cli.Context) (string, error) {
+	if !cctx.Bool("mnemonic-password") {
+		return "", nil
+	}
+	return readPassphrase("Mnemonic password: ")
+}
+
+// importMnemonicKeys 派生并导入私钥, 打印地址和对应的路径
+func importMnemonicKeys(cctx *cli.Context, walletAPI api.WalletAPI, mnemonic string, start, count int) error {
+	password, err := mnemonicPassword(cctx)
+	if err != nil {
+		return err
+	}
+	keys, err := mnemonicKeys(mnemonic, password, start, count)
+	if err != nil {
+		return err
+	}
+	for i, ki := range keys {
+		path := fmt.Sprintf("%s/%d", filecoinPath, start+i)
+		addr, err := walletAPI.WalletImport(cctx.Context, ki)
+		if xerrors.Is(err, types.ErrKeyExists) {
+			fmt.Printf("%s\t(already in wallet)\n", path)
+			continue
+		}
+		if err != nil {
+			return xerrors.Errorf("importing key %s: %w", path, err)
+		}
+		fmt.Printf("%s\t%s\n", path, addr)
+	}
+	return nil
+}
+
+func mnemonicFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "count",
+			Usage: "number of addresses to derive",
+			Value: 1,
+		},
+		&cli.BoolFlag{
+			Name:  "mnemonic-password",
+			Usage: "prompt for the optional BIP-39 password protecting the mnemonic",
+		},
+	}
+}
+
+var walletRestore = &cli.Command{
+	Name:  "restore",
+	Usage: "Restore secp256k1 keys from a BIP-39 mnemonic",
+	Description: "Keys are derived along " + filecoinPath + `/i, the mnemonic is read from stdin.
+   Keys already in the wallet are skipped.`,
+	Flags: append(mnemonicFlags(),
+		&cli.IntFlag{
+			Name:  "start",
+			Usage: "index of the first address to derive",
+		},
+	),
+	Action: func(cctx *cli.Context) error {
+		if cctx.Int("count") < 1 || cctx.Int("start") < 0 {
+			return ShowHelp(cctx, xerrors.New("count must be positive and start must not be negative"))
+		}
+		walletAPI, err := newWalletAPI(cctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(os.Stderr, "Enter mnemonic: ")
+		mnemonic, err := readLine()
+		if err != nil {
+			return err
+		}
+		mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+		return importMnemonicKeys(cctx, walletAPI, mnemonic, cctx.Int("start"), cctx.Int("count"))
+	},
+}
+
+// newMnemonic 生成助记词并导入派生的私钥, 助记词不保存, 只输出一次
+func newMnemonic(cctx *cli.Context, walletAPI api.WalletAPI) error {
+	words := cctx.Int("words")
+	if words != 12 && words != 24 {
+		return xerrors.New("words must be 12 or 24")
+	}
+	if cctx.Int("count") < 1 {
+		return xerrors.New("count must be positive")
+	}
+	entropy, err := bip39.NewEntropy(words / 3 * 32)
+	if err != nil {
+		return err
+	}
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Write down the mnemonic below, it is not stored and is the only way to restore these keys:")
+	fmt.Println(mnemonic)
+	return importMnemonicKeys(cctx, walletAPI, mnemonic, 0, cctx.Int("count"))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// BIP-32 test vector 1
+	seed, err := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	require.NoError(t, err)
+	for path, key := range map[string]string{
+		"m":           "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35",
+		"m/0'":        "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea",
+		"m/0'/1":      "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368",
+		"m/0h/1/2'":   "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca",
+		"m/0'/1/2'/2": "0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4",
+	} {
+		p, err := parsePath(path)
+		require.NoError(t, err)
+		k, err := deriveKey(seed, p)
+		require.NoError(t, err)
+		require.Equal(t, key, hex.EncodeToString(k), path)
+	}
+
+	_, err = parsePath("44'/461'")
+	require.Error(t, err)
+}
+
+func TestMnemonicKeys(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	keys, err := mnemonicKeys(mnemonic, "", 0, 3)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+
+	// 从中间序号恢复得到相同的私钥
+	restored, err := mnemonicKeys(mnemonic, "", 2, 1)
+	require.NoError(t, err)
+	require.Equal(t, keys[2].PrivateKey, restored[0].PrivateKey)
+
+	// 助记词密码不同派生的私钥不同
+	other, err := mnemonicKeys(mnemonic, "password", 0, 1)
+	require.NoError(t, err)
+	require.NotEqual(t, keys[0].PrivateKey, other[0].PrivateKey)
+
+	_, err = mnemonicKeys("abandon abandon abandon", "", 0, 1)
+	require.Error(t, err)
+}
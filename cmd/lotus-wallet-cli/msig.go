@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/chain/actors"
+	multisig0 "github.com/filecoin-project/lotus/chain/actors/builtin/multisig"
+	"github.com/filecoin-project/lotus/chain/types"
+	multisig2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/multisig"
+	"github.com/guoxiaopeng875/lotus-adapter/envelope"
+	"github.com/urfave/cli/v2"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// 构造多签消息使用的actor版本, 创建多签时决定新actor的代码
+const msigActorsVersion = actors.Version2
+
+var msigCmd = &cli.Command{
+	Name:  "msig",
+	Usage: "Build and sign multisig messages offline, print the signed messages for mpool-push",
+	Subcommands: []*cli.Command{
+		msigCreateCmd,
+		msigProposeCmd,
+		msigApproveCmd,
+		msigCancelCmd,
+		msigAddSignerCmd,
+		msigRemoveSignerCmd,
+		msigSwapSignerCmd,
+		msigLockBalanceCmd,
+		msigSetThresholdCmd,
+	},
+}
+
+// msigFlags 所有多签命令都需要的发送地址和gas参数
+func msigFlags(usage string, flags ...cli.Flag) []cli.Flag {
+	flags = append(flags, &cli.StringFlag{
+		Name:  "from",
+		Usage: usage,
+	}, yesFlag())
+	return append(flags, gasFlags()...)
+}
+
+var msigCreateCmd = &cli.Command{
+	Name:      "create",
+	Usage:     "Create a new multisig wallet",
+	ArgsUsage: "[address1 address2 ...]",
+	Flags: msigFlags("account to send the create message from",
+		&cli.Uint64Flag{
+			Name:  "required",
+			Usage: "number of approvals required, defaults to the number of signers",
+		},
+		&cli.StringFlag{
+			Name:  "value",
+			Usage: "initial funds to give to multisig",
+			Value: "0",
+		},
+		&cli.Int64Flag{
+			Name:  "start-epoch",
+			Usage: "epoch the vesting of the initial funds starts at",
+		},
+		&cli.Int64Flag{
+			Name:  "duration",
+			Usage: "length of the period over which funds unlock",
+		},
+	),
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() < 1 {
+			return ShowHelp(cctx, xerrors.New("multisigs must have at least one signer"))
+		}
+
+		var signers []address.Address
+		for _, a := range cctx.Args().Slice() {
+			addr, err := address.NewFromString(a)
+			if err != nil {
+				return err
+			}
+			signers = append(signers, addr)
+		}
+		value, err := types.ParseFIL(cctx.String("value"))
+		if err != nil {
+			return err
+		}
+		from, err := msigFrom(cctx)
+		if err != nil {
+			return err
+		}
+
+		msg, err := multisig0.Message(msigActorsVersion, from).Create(signers, cctx.Uint64("required"),
+			abi.ChainEpoch(cctx.Int64("start-epoch")), abi.ChainEpoch(cctx.Int64("duration")), types.BigInt(value))
+		if err != nil {
+			return err
+		}
+		return signAndPrint(cctx, msg, nil)
+	},
+}
+
+var msigProposeCmd = &cli.Command{
+	Name:      "propose",
+	Usage:     "Propose a multisig transaction",
+	ArgsUsage: "[multisigAddress destinationAddress value <methodId methodParams> (optional)]",
+	Flags:     msigFlags("account to send the propose message from"),
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() < 3 {
+			return ShowHelp(cctx, fmt.Errorf("must pass at least multisig address, destination, and value"))
+		}
+
+		if cctx.Args().Len() > 3 && cctx.Args().Len() != 5 {
+			return ShowHelp(cctx, fmt.Errorf("must either pass three or five arguments"))
+		}
+
+		msig, err := address.NewFromString(cctx.Args().Get(0))
+		if err != nil {
+			return err
+		}
+
+		dest, err := address.NewFromString(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+
+		value, err := types.ParseFIL(cctx.Args().Get(2))
+		if err != nil {
+			return err
+		}
+
+		var method uint64
+		var params []byte
+		if cctx.Args().Len() == 5 {
+			m, err := strconv.ParseUint(cctx.Args().Get(3), 10, 64)
+			if err != nil {
+				return err
+			}
+			method = m
+
+			p, err := hex.DecodeString(cctx.Args().Get(4))
+			if err != nil {
+				return err
+			}
+			params = p
+		}
+
+		from, err := msigFrom(cctx)
+		if err != nil {
+			return err
+		}
+
+		msg, err := multisig0.Message(msigActorsVersion, from).Propose(msig, dest, types.BigInt(value), abi.MethodNum(method), params)
+		if err != nil {
+			return xerrors.Errorf("buildProposeMessage: %w", err)
+		}
+		return signAndPrint(cctx, msg, msigActors(msig))
+	},
+}
+
+var msigApproveCmd = &cli.Command{
+	Name:      "approve",
+	Usage:     "Approve a multisig message",
+	ArgsUsage: "<multisigAddress messageId> [proposerAddress destination value [methodId methodParams]]",
+	Description: `When the proposal is given, the approval only succeeds if the pending
+   transaction matches it exactly. The proposer must be an ID address.`,
+	Flags: msigFlags("account to send the approve message from"),
+	Action: func(cctx *cli.Context) error {
+		msig, txid, hash, err := parseTxnArgs(cctx)
+		if err != nil {
+			return err
+		}
+		from, err := msigFrom(cctx)
+		if err != nil {
+			return err
+		}
+
+		msg, err := multisig0.Message(msigActorsVersion, from).Approve(msig, txid, hash)
+		if err != nil {
+			return err
+		}
+		return signAndPrint(cctx, msg, msigActors(msig))
+	},
+}
+
+var msigCancelCmd = &cli.Command{
+	Name:      "cancel",
+	Usage:     "Cancel a multisig message proposed by the sender",
+	ArgsUsage: "<multisigAddress messageId> [proposerAddress destination value [methodId methodParams]]",
+	Description: `When the proposal is given, the cancel only succeeds if the pending
+   transaction matches it exactly. The proposer must be an ID address.`,
+	Flags: msigFlags("account that proposed the message"),
+	Action: func(cctx *cli.Context) error {
+		msig, txid, hash, err := parseTxnArgs(cctx)
+		if err != nil {
+			return err
+		}
+		from, err := msigFrom(cctx)
+		if err != nil {
+			return err
+		}
+
+		msg, err := multisig0.Message(msigActorsVersion, from).Cancel(msig, txid, hash)
+		if err != nil {
+			return err
+		}
+		return signAndPrint(cctx, msg, msigActors(msig))
+	},
+}
+
+var msigAddSignerCmd = &cli.Command{
+	Name:      "add-signer",
+	Usage:     "Propose adding a signer to the multisig",
+	ArgsUsage: "<multisigAddress signer>",
+	Flags: msigFlags("account to send the propose message from",
+		&cli.BoolFlag{
+			Name:  "increase-threshold",
+			Usage: "whether the number of required signers should be increased",
+		},
+	),
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 2 {
+			return ShowHelp(cctx, xerrors.New("must pass multisig address and signer address"))
+		}
+		signer, err := address.NewFromString(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+		return proposeToSelf(cctx, multisig0.Methods.AddSigner, &multisig2.AddSignerParams{
+			Signer:   signer,
+			Increase: cctx.Bool("increase-threshold"),
+		})
+	},
+}
+
+var msigRemoveSignerCmd = &cli.Command{
+	Name:      "remove-signer",
+	Usage:     "Propose removing a signer from the multisig",
+	ArgsUsage: "<multisigAddress signer>",
+	Flags: msigFlags("account to send the propose message from",
+		&cli.BoolFlag{
+			Name:  "decrease-threshold",
+			Usage: "whether the number of required signers should be decreased",
+		},
+	),
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 2 {
+			return ShowHelp(cctx, xerrors.New("must pass multisig address and signer address"))
+		}
+		signer, err := address.NewFromString(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+		return proposeToSelf(cctx, multisig0.Methods.RemoveSigner, &multisig2.RemoveSignerParams{
+			Signer:   signer,
+			Decrease: cctx.Bool("decrease-threshold"),
+		})
+	},
+}
+
+var msigSwapSignerCmd = &cli.Command{
+	Name:      "swap-signer",
+	Usage:     "Propose replacing a signer of the multisig",
+	ArgsUsage: "<multisigAddress oldSigner newSigner>",
+	Flags:     msigFlags("account to send the propose message from"),
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 3 {
+			return ShowHelp(cctx, xerrors.New("must pass multisig address, old signer and new signer"))
+		}
+		oldSigner, err := address.NewFromString(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+		newSigner, err := address.NewFromString(cctx.Args().Get(2))
+		if err != nil {
+			return err
+		}
+		return proposeToSelf(cctx, multisig0.Methods.SwapSigner, &multisig2.SwapSignerParams{
+			From: oldSigner,
+			To:   newSigner,
+		})
+	},
+}
+
+var msigLockBalanceCmd = &cli.Command{
+	Name:      "lock-balance",
+	Usage:     "Propose locking part of the multisig balance, unlocking linearly over a duration",
+	ArgsUsage: "<multisigAddress startEpoch unlockDuration amount>",
+	Flags:     msigFlags("account to send the propose message from"),
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 4 {
+			return ShowHelp(cctx, xerrors.New("must pass multisig address, start epoch, unlock duration and amount"))
+		}
+		start, err := strconv.ParseInt(cctx.Args().Get(1), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing start epoch: %w", err)
+		}
+		duration, err := strconv.ParseInt(cctx.Args().Get(2), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing unlock duration: %w", err)
+		}
+		amount, err := types.ParseFIL(cctx.Args().Get(3))
+		if err != nil {
+			return err
+		}
+		return proposeToSelf(cctx, multisig0.Methods.LockBalance, &multisig2.LockBalanceParams{
+			StartEpoch:     abi.ChainEpoch(start),
+			UnlockDuration: abi.ChainEpoch(duration),
+			Amount:         types.BigInt(amount),
+		})
+	},
+}
+
+var msigSetThresholdCmd = &cli.Command{
+	Name:      "set-threshold",
+	Usage:     "Propose changing the number of approvals required",
+	ArgsUsage: "<multisigAddress threshold>",
+	Flags:     msigFlags("account to send the propose message from"),
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 2 {
+			return ShowHelp(cctx, xerrors.New("must pass multisig address and new threshold"))
+		}
+		threshold, err := strconv.ParseUint(cctx.Args().Get(1), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing threshold: %w", err)
+		}
+		return proposeToSelf(cctx, multisig0.Methods.ChangeNumApprovalsThreshold, &multisig2.ChangeNumApprovalsThresholdParams{
+			NewThreshold: threshold,
+		})
+	},
+}
+
+// msigActors 多签命令的目标地址一定是多签
+func msigActors(msig address.Address) map[address.Address]string {
+	return map[address.Address]string{msig: envelope.ActorMultisig}
+}
+
+func msigFrom(cctx *cli.Context) (address.Address, error) {
+	if !cctx.IsSet("from") {
+		return address.Undef, ShowHelp(cctx, xerrors.New("must specify --from"))
+	}
+	return address.NewFromString(cctx.String("from"))
+}
+
+// parseTxnArgs 解析 <multisig> <txid> [proposer destination value [method params]], 给出提议内容时返回用于校验的哈希数据
+func parseTxnArgs(cctx *cli.Context) (address.Address, uint64, *multisig0.ProposalHashData, error) {
+	args := cctx.Args()
+	switch args.Len() {
+	case 2, 5, 7:
+	default:
+		return address.Undef, 0, nil, ShowHelp(cctx, xerrors.New("must pass multisig address and message ID, optionally followed by proposer, destination, value [, method, params]"))
+	}
+
+	msig, err := address.NewFromString(args.Get(0))
+	if err != nil {
+		return address.Undef, 0, nil, err
+	}
+	txid, err := strconv.ParseUint(args.Get(1), 10, 64)
+	if err != nil {
+		return address.Undef, 0, nil, xerrors.Errorf("parsing message ID: %w", err)
+	}
+	if args.Len() == 2 {
+		return msig, txid, nil, nil
+	}
+
+	proposer, err := address.NewFromString(args.Get(2))
+	if err != nil {
+		return address.Undef, 0, nil, err
+	}
+	if proposer.Protocol() != address.ID {
+		return address.Undef, 0, nil, xerrors.Errorf("proposer must be an ID address, was %s", proposer)
+	}
+	dest, err := address.NewFromString(args.Get(3))
+	if err != nil {
+		return address.Undef, 0, nil, err
+	}
+	value, err := types.ParseFIL(args.Get(4))
+	if err != nil {
+		return address.Undef, 0, nil, err
+	}
+	hash := &multisig0.ProposalHashData{
+		Requester: proposer,
+		To:        dest,
+		Value:     types.BigInt(value),
+	}
+	if args.Len() == 7 {
+		method, err := strconv.ParseUint(args.Get(5), 10, 64)
+		if err != nil {
+			return address.Undef, 0, nil, xerrors.Errorf("parsing method: %w", err)
+		}
+		params, err := hex.DecodeString(args.Get(6))
+		if err != nil {
+			return address.Undef, 0, nil, xerrors.Errorf("parsing params: %w", err)
+		}
+		hash.Method = abi.MethodNum(method)
+		hash.Params = params
+	}
+	return msig, txid, hash, nil
+}
+
+// proposeToSelf 向多签自身提议调用 method, 用于修改签名人, 阈值和锁定余额
+func proposeToSelf(cctx *cli.Context, method abi.MethodNum, params cbg.CBORMarshaler) error {
+	msig, err := address.NewFromString(cctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	from, err := msigFrom(cctx)
+	if err != nil {
+		return err
+	}
+	enc, err := actors.SerializeParams(params)
+	if err != nil {
+		return err
+	}
+	msg, err := multisig0.Message(msigActorsVersion, from).Propose(msig, msig, big.Zero(), method, enc)
+	if err != nil {
+		return err
+	}
+	return signAndPrint(cctx, msg, msigActors(msig))
+}
+
+// signAndPrint 填上命令行指定的gas参数, 确认后签名并输出可用于 mpool-push 的hex. actors 为已知的地址到actor类型的映射
+func signAndPrint(cctx *cli.Context, msg *types.Message, actors map[address.Address]string) error {
+	walletAPI, err := newWalletAPI(cctx)
+	if err != nil {
+		return err
+	}
+	if err := setOfflineGasParams(cctx, msg); err != nil {
+		return err
+	}
+	if err := confirmSign(cctx, envelope.Describe(msg, actors)); err != nil {
+		return err
+	}
+	msgStr, err := signMsg(withActors(cctx.Context, actors), walletAPI, msg)
+	if err != nil {
+		return err
+	}
+	fmt.Println(msgStr)
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	builtin2 "github.com/filecoin-project/specs-actors/v2/actors/builtin"
+	multisig2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/multisig"
+	"golang.org/x/xerrors"
+)
+
+// 钱包目录中的签名策略文件, 不存在时不做限制
+const policyFile = "policy.json"
+
+// policyRule 对一个地址签名的消息的限制, 没有配置的项不限制
+type policyRule struct {
+	// 单条消息最多转出的金额, 如 "10 FIL"
+	MaxValue string `json:"max_value,omitempty"`
+	// 允许的目标地址, 按字面比较, ID地址和公钥地址需要分别列出
+	AllowedTo []string `json:"allowed_to,omitempty"`
+	// 允许调用的方法号, 转账为0
+	AllowedMethods []abi.MethodNum `json:"allowed_methods,omitempty"`
+	// GasFeeCap 的上限, 如 "5000000000 attofil"
+	MaxFeeCap string `json:"max_fee_cap,omitempty"`
+	// 是否允许多签的 Approve 和 Cancel. 批准会执行链上待处理的交易, 其中的调用无法在签名时检查,
+	// 所以默认拒绝; 允许时参数中必须带有 ProposalHash, 只能批准确认过内容的交易
+	AllowApprove bool `json:"allow_approve,omitempty"`
+
+	maxValue  *abi.TokenAmount
+	allowedTo map[address.Address]struct{}
+	maxFeeCap *abi.TokenAmount
+}
+
+// signPolicy 签名策略, 有规则的地址只能签名符合规则的链上消息
+type signPolicy struct {
+	// 没有单独配置的地址使用的规则
+	Default *policyRule `json:"default,omitempty"`
+	// 按签名地址配置的规则, 钱包只用公钥地址(f1/f3)签名, 不能使用ID地址
+	Addresses map[string]*policyRule `json:"addresses,omitempty"`
+
+	rules map[address.Address]*policyRule
+}
+
+// loadPolicy 读取并检查策略文件, 文件不存在时返回nil
+func loadPolicy(path string) (*signPolicy, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p signPolicy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, xerrors.Errorf("decoding policy %s: %w", path, err)
+	}
+	if err := p.init(); err != nil {
+		return nil, xerrors.Errorf("invalid policy %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+func (p *signPolicy) init() error {
+	if p.Default != nil {
+		if err := p.Default.init(); err != nil {
+			return xerrors.Errorf("default: %w", err)
+		}
+	}
+	p.rules = make(map[address.Address]*policyRule, len(p.Addresses))
+	for a, r := range p.Addresses {
+		addr, err := address.NewFromString(a)
+		if err != nil {
+			return xerrors.Errorf("parsing address %s: %w", a, err)
+		}
+		if addr.Protocol() != address.SECP256K1 && addr.Protocol() != address.BLS {
+			return xerrors.Errorf("%s: rules must use the secp256k1 or BLS key address the wallet signs with", a)
+		}
+		if r == nil {
+			return xerrors.Errorf("%s: empty rule", a)
+		}
+		if err := r.init(); err != nil {
+			return xerrors.Errorf("%s: %w", a, err)
+		}
+		p.rules[addr] = r
+	}
+	return nil
+}
+
+func (r *policyRule) init() error {
+	if r.MaxValue != "" {
+		v, err := types.ParseFIL(r.MaxValue)
+		if err != nil {
+			return xerrors.Errorf("parsing max_value: %w", err)
+		}
+		r.maxValue = (*abi.TokenAmount)(&v)
+	}
+	if r.MaxFeeCap != "" {
+		v, err := types.ParseFIL(r.MaxFeeCap)
+		if err != nil {
+			return xerrors.Errorf("parsing max_fee_cap: %w", err)
+		}
+		r.maxFeeCap = (*abi.TokenAmount)(&v)
+	}
+	if r.AllowedTo != nil {
+		r.allowedTo = make(map[address.Address]struct{}, len(r.AllowedTo))
+		for _, a := range r.AllowedTo {
+			addr, err := address.NewFromString(a)
+			if err != nil {
+				return xerrors.Errorf("parsing allowed_to address %s: %w", a, err)
+			}
+			r.allowedTo[addr] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func (p *signPolicy) rule(signer address.Address) *policyRule {
+	if r, ok := p.rules[signer]; ok {
+		return r
+	}
+	return p.Default
+}
+
+// checkSign 检查签名请求, 有规则的地址不能签名链上消息以外的数据, 否则可以绕过规则直接签名消息CID
+func (p *signPolicy) checkSign(signer address.Address, data []byte, meta api.MsgMeta) error {
+	r := p.rule(signer)
+	if r == nil {
+		return nil
+	}
+	if meta.Type != api.MTChainMsg {
+		return xerrors.Errorf("signing policy violation for %s: signing %s data is not allowed, only chain messages", signer, meta.Type)
+	}
+	msg, err := types.DecodeMessage(meta.Extra)
+	if err != nil {
+		return xerrors.Errorf("signing policy violation for %s: decoding message: %w", signer, err)
+	}
+	if !bytes.Equal(msg.Cid().Bytes(), data) {
+		return xerrors.Errorf("signing policy violation for %s: signed data does not match the message", signer)
+	}
+	if err := r.check(msg); err != nil {
+		return xerrors.Errorf("signing policy violation for %s: %w", signer, err)
+	}
+	return nil
+}
+
+func (r *policyRule) check(msg *types.Message) error {
+	if err := r.checkCall(msg.To, msg.Value, msg.Method); err != nil {
+		return err
+	}
+	if r.maxFeeCap != nil && msg.GasFeeCap.GreaterThan(*r.maxFeeCap) {
+		return xerrors.Errorf("gas fee cap %s attoFIL exceeds the maximum %s attoFIL", msg.GasFeeCap, *r.maxFeeCap)
+	}
+
+	// 离线无法确认目标actor的类型, 这几个方法号都按多签处理, 参数无法解析时拒绝
+	switch msg.Method {
+	case builtin2.MethodsMultisig.Propose:
+		// 多签提议执行后由多签转出, 提议的调用同样要符合规则
+		var pp multisig2.ProposeParams
+		if err := pp.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return xerrors.Errorf("multisig proposal: decoding params: %w", err)
+		}
+		if err := r.checkCall(pp.To, pp.Value, pp.Method); err != nil {
+			return xerrors.Errorf("multisig proposal: %w", err)
+		}
+	case builtin2.MethodsMultisig.Approve, builtin2.MethodsMultisig.Cancel:
+		if !r.AllowApprove {
+			return xerrors.Errorf("method %d is treated as multisig approve or cancel, which is not allowed without allow_approve", msg.Method)
+		}
+		var tp multisig2.TxnIDParams
+		if err := tp.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return xerrors.Errorf("multisig approval: decoding params: %w", err)
+		}
+		if len(tp.ProposalHash) == 0 {
+			return xerrors.New("multisig approval: proposal hash is required, otherwise any pending transaction with this ID is executed")
+		}
+	}
+	return nil
+}
+
+func (r *policyRule) checkCall(to address.Address, value abi.TokenAmount, method abi.MethodNum) error {
+	if r.maxValue != nil && value.GreaterThan(*r.maxValue) {
+		return xerrors.Errorf("value %s exceeds the maximum %s per message", types.FIL(value), types.FIL(*r.maxValue))
+	}
+	if r.allowedTo != nil {
+		if _, ok := r.allowedTo[to]; !ok {
+			return xerrors.Errorf("destination %s is not in allowed_to", to)
+		}
+	}
+	if r.AllowedMethods != nil {
+		allowed := false
+		for _, m := range r.AllowedMethods {
+			if m == method {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return xerrors.Errorf("method %d is not in allowed_methods", method)
+		}
+	}
+	return nil
+}
+
+// policyWallet 签名前检查策略
+type policyWallet struct {
+	api.WalletAPI
+	policy *signPolicy
+}
+
+func (w *policyWallet) WalletSign(ctx context.Context, signer address.Address, toSign []byte, meta api.MsgMeta) (*crypto.Signature, error) {
+	if err := w.policy.checkSign(signer, toSign, meta); err != nil {
+		return nil, err
+	}
+	return w.WalletAPI.WalletSign(ctx, signer, toSign, meta)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	builtin2 "github.com/filecoin-project/specs-actors/v2/actors/builtin"
+	multisig2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/multisig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), policyFile)
+	p, err := loadPolicy(path)
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	// 规则只能按公钥地址配置
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"addresses": {"f01000": {"max_value": "10 FIL"}}}`), 0644))
+	_, err = loadPolicy(path)
+	require.Error(t, err)
+
+	signer, err := address.NewSecp256k1Address([]byte("signer"))
+	require.NoError(t, err)
+	approver, err := address.NewSecp256k1Address([]byte("approver"))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, []byte(fmt.Sprintf(`{
+  "addresses": {
+    "%s": {
+      "max_value": "10 FIL",
+      "allowed_to": ["f01001", "f01002"],
+      "allowed_methods": [0, 2],
+      "max_fee_cap": "1000 attofil"
+    },
+    "%s": {
+      "allow_approve": true
+    }
+  }
+}`, signer, approver)), 0644))
+	p, err = loadPolicy(path)
+	require.NoError(t, err)
+
+	addr := func(id uint64) address.Address {
+		a, err := address.NewIDAddress(id)
+		require.NoError(t, err)
+		return a
+	}
+	violation := func(reason string) string {
+		return fmt.Sprintf("signing policy violation for %s: %s", signer, reason)
+	}
+	checkAs := func(from address.Address, msg *types.Message) error {
+		msg.From = from
+		mb, err := msg.ToStorageBlock()
+		require.NoError(t, err)
+		return p.checkSign(from, mb.Cid().Bytes(), api.MsgMeta{Type: api.MTChainMsg, Extra: mb.RawData()})
+	}
+	check := func(msg *types.Message) error {
+		return checkAs(signer, msg)
+	}
+	send := func(to address.Address, fil int64) *types.Message {
+		return &types.Message{To: to, Value: types.FromFil(uint64(fil)), GasFeeCap: abi.NewTokenAmount(100)}
+	}
+
+	require.NoError(t, check(send(addr(1001), 10)))
+	require.EqualError(t, check(send(addr(1001), 11)), violation("value 11 FIL exceeds the maximum 10 FIL per message"))
+	require.EqualError(t, check(send(addr(1003), 1)), violation("destination f01003 is not in allowed_to"))
+
+	msg := send(addr(1001), 1)
+	msg.Method = 3
+	require.EqualError(t, check(msg), violation("method 3 is not in allowed_methods"))
+	msg = send(addr(1001), 1)
+	msg.GasFeeCap = abi.NewTokenAmount(1001)
+	require.EqualError(t, check(msg), violation("gas fee cap 1001 attoFIL exceeds the maximum 1000 attoFIL"))
+
+	// 多签提议的调用同样检查
+	buf := new(bytes.Buffer)
+	require.NoError(t, (&multisig2.ProposeParams{To: addr(1003), Value: types.FromFil(1)}).MarshalCBOR(buf))
+	msg = send(addr(1002), 0)
+	msg.Method = builtin2.MethodsMultisig.Propose
+	msg.Params = buf.Bytes()
+	require.EqualError(t, check(msg), violation("multisig proposal: destination f01003 is not in allowed_to"))
+
+	// 无法解析的提议不能跳过检查
+	msg = send(addr(1002), 0)
+	msg.Method = builtin2.MethodsMultisig.Propose
+	msg.Params = []byte{0x01, 0x02}
+	err = check(msg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "multisig proposal: decoding params")
+
+	// 有规则的地址不能签名任意数据, 没有规则的地址不受限制
+	require.Error(t, p.checkSign(signer, []byte("data"), api.MsgMeta{Type: api.MTUnknown}))
+	other, err := address.NewSecp256k1Address([]byte("other"))
+	require.NoError(t, err)
+	require.NoError(t, p.checkSign(other, []byte("data"), api.MsgMeta{Type: api.MTUnknown}))
+
+	// 批准需要 allow_approve 和 ProposalHash
+	approve := func(hash []byte) *types.Message {
+		buf := new(bytes.Buffer)
+		require.NoError(t, (&multisig2.TxnIDParams{ID: 1, ProposalHash: hash}).MarshalCBOR(buf))
+		msg := send(addr(1002), 0)
+		msg.Method = builtin2.MethodsMultisig.Approve
+		msg.Params = buf.Bytes()
+		return msg
+	}
+	require.NoError(t, checkAs(approver, approve([]byte("hash"))))
+	require.Error(t, checkAs(approver, approve(nil)))
+	require.NoError(t, ioutil.WriteFile(path, []byte(fmt.Sprintf(`{"addresses": {"%s": {"max_value": "10 FIL"}}}`, approver)), 0644))
+	p, err = loadPolicy(path)
+	require.NoError(t, err)
+	require.Error(t, checkAs(approver, approve([]byte("hash"))))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/guoxiaopeng875/lotus-adapter/envelope"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+var sendCmd = &cli.Command{
+	Name:      "send",
+	Usage:     "Build and sign a message sending FIL, print the signed message for mpool-push",
+	ArgsUsage: "<targetAddress> <amount>",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "account to send funds from",
+		},
+		&cli.Uint64Flag{
+			Name:  "method",
+			Usage: "specify method to invoke",
+			Value: 0,
+		},
+		&cli.StringFlag{
+			Name:  "params",
+			Usage: "specify invocation parameters in hex",
+		},
+		yesFlag(),
+	}, gasFlags()...),
+	Action: func(cctx *cli.Context) error {
+		walletAPI, err := newWalletAPI(cctx)
+		if err != nil {
+			return err
+		}
+
+		if cctx.Args().Len() != 2 {
+			return ShowHelp(cctx, fmt.Errorf("'send' expects two arguments, target and amount"))
+		}
+		if !cctx.IsSet("from") {
+			return ShowHelp(cctx, xerrors.New("must specify --from"))
+		}
+
+		from, err := address.NewFromString(cctx.String("from"))
+		if err != nil {
+			return err
+		}
+		to, err := address.NewFromString(cctx.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		value, err := types.ParseFIL(cctx.Args().Get(1))
+		if err != nil {
+			return xerrors.Errorf("parsing amount: %w", err)
+		}
+		params, err := hex.DecodeString(cctx.String("params"))
+		if err != nil {
+			return xerrors.Errorf("parsing params: %w", err)
+		}
+
+		msg := &types.Message{
+			From:   from,
+			To:     to,
+			Value:  types.BigInt(value),
+			Method: abi.MethodNum(cctx.Uint64("method")),
+			Params: params,
+		}
+		if err := setOfflineGasParams(cctx, msg); err != nil {
+			return err
+		}
+
+		if err := confirmSign(cctx, envelope.Describe(msg, nil)); err != nil {
+			return err
+		}
+		msgStr, err := signMsg(cctx.Context, walletAPI, msg)
+		if err != nil {
+			return err
+		}
+		fmt.Println(msgStr)
+		return nil
+	},
+}
+
+// setOfflineGasParams 设置gas参数并检查消息能否上链. 离线签名无法估算gas, gas为0的消息不会被打包
+func setOfflineGasParams(cctx *cli.Context, msg *types.Message) error {
+	if err := setGasParamsFromCCtx(cctx, msg); err != nil {
+		return err
+	}
+	if msg.GasLimit <= 0 || msg.GasFeeCap.IsZero() {
+		return ShowHelp(cctx, xerrors.New("must specify --gas-limit and --gas-feecap"))
+	}
+	if err := msg.ValidForBlockInclusion(0, build.NewestNetworkVersion); err != nil {
+		return xerrors.Errorf("invalid message: %w", err)
+	}
+	return nil
+}
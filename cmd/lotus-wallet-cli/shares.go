@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/guoxiaopeng875/lotus-adapter/shamir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// 私钥分片的格式版本
+const shareVersion = 1
+
+// 分片内容: 版本, 恢复需要的份数k, 之后是 shamir.Split 输出的一份.
+// 拆分的是 json-lotus 格式的 KeyInfo 加上它sha256的前4字节, 用于发现分片不匹配或损坏
+const shareHeaderLen = 2
+
+// parseThreshold 解析 k/n
+func parseThreshold(s string) (int, int, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, 0, xerrors.Errorf("invalid threshold %s, expected k/n", s)
+	}
+	k, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, xerrors.Errorf("invalid threshold %s: %w", s, err)
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, xerrors.Errorf("invalid threshold %s: %w", s, err)
+	}
+	return k, n, nil
+}
+
+// splitKey 把私钥拆成n份, 任意k份可以恢复
+func splitKey(ki *types.KeyInfo, k, n int) ([][]byte, error) {
+	b, err := json.Marshal(ki)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	parts, err := shamir.Split(append(b, sum[:4]...), k, n)
+	if err != nil {
+		return nil, err
+	}
+	shares := make([][]byte, n)
+	for i, p := range parts {
+		shares[i] = append([]byte{shareVersion, byte(k)}, p...)
+	}
+	return shares, nil
+}
+
+// combineKey 从分片恢复私钥
+func combineKey(shares [][]byte) (*types.KeyInfo, error) {
+	if len(shares) == 0 {
+		return nil, xerrors.New("no shares")
+	}
+	k := 0
+	parts := make([][]byte, len(shares))
+	for i, s := range shares {
+		if len(s) <= shareHeaderLen || s[0] != shareVersion {
+			return nil, xerrors.Errorf("share %d: unsupported share format", i+1)
+		}
+		if k != 0 && int(s[1]) != k {
+			return nil, xerrors.Errorf("share %d: shares come from different splits", i+1)
+		}
+		k = int(s[1])
+		parts[i] = s[shareHeaderLen:]
+	}
+	if len(shares) < k {
+		return nil, xerrors.Errorf("need %d shares to restore the key, got %d", k, len(shares))
+	}
+
+	secret, err := shamir.Combine(parts)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) < 4 {
+		return nil, xerrors.New("share is too short")
+	}
+	b, check := secret[:len(secret)-4], secret[len(secret)-4:]
+	if sum := sha256.Sum256(b); !bytes.Equal(sum[:4], check) {
+		return nil, xerrors.New("checksum mismatch, the shares are corrupted or belong to different keys")
+	}
+	var ki types.KeyInfo
+	if err := json.Unmarshal(b, &ki); err != nil {
+		return nil, xerrors.Errorf("decoding key: %w", err)
+	}
+	return &ki, nil
+}
+
+// exportKeyShares 输出私钥分片, 指定目录时每份写入单独的文件, 否则每行打印一份hex
+func exportKeyShares(cctx *cli.Context, addr address.Address, ki *types.KeyInfo) error {
+	k, n, err := parseThreshold(cctx.String("shamir"))
+	if err != nil {
+		return err
+	}
+	shares, err := splitKey(ki, k, n)
+	if err != nil {
+		return err
+	}
+
+	dir := cctx.String("shamir-dir")
+	if dir == "" {
+		fmt.Fprintf(os.Stderr, "Key %s split into %d shares, any %d restore it:\n", addr, n, k)
+		for _, s := range shares {
+			fmt.Println(hex.EncodeToString(s))
+		}
+		return nil
+	}
+	for i, s := range shares {
+		path := filepath.Join(dir, fmt.Sprintf("%s.share%d", addr, i+1))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(f, hex.EncodeToString(s)); err != nil {
+			f.Close() // nolint
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// readKeyShares 从参数给出的文件读取分片, 没有参数时从标准输入逐份读取直到足够恢复
+func readKeyShares(cctx *cli.Context) (*types.KeyInfo, error) {
+	var shares [][]byte
+	if cctx.Args().Present() {
+		for _, path := range cctx.Args().Slice() {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			s, err := hex.DecodeString(strings.TrimSpace(string(b)))
+			if err != nil {
+				return nil, xerrors.Errorf("decoding share %s: %w", path, err)
+			}
+			shares = append(shares, s)
+		}
+		return combineKey(shares)
+	}
+
+	for {
+		fmt.Fprintf(os.Stderr, "Enter share %d: ", len(shares)+1)
+		line, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		s, err := hex.DecodeString(strings.TrimSpace(line))
+		if err != nil {
+			return nil, xerrors.Errorf("decoding share: %w", err)
+		}
+		if len(s) <= shareHeaderLen {
+			return nil, xerrors.New("share is too short")
+		}
+		shares = append(shares, s)
+		if len(shares) >= int(s[1]) {
+			return combineKey(shares)
+		}
+	}
+}
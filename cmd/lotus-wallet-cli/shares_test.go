@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyShares(t *testing.T) {
+	ki := &types.KeyInfo{Type: types.KTSecp256k1, PrivateKey: []byte("0123456789abcdef0123456789abcdef")}
+	shares, err := splitKey(ki, 2, 3)
+	require.NoError(t, err)
+
+	got, err := combineKey([][]byte{shares[2], shares[0]})
+	require.NoError(t, err)
+	require.Equal(t, ki, got)
+
+	_, err = combineKey(shares[:1])
+	require.EqualError(t, err, "need 2 shares to restore the key, got 1")
+
+	// 其他私钥的分片
+	other, err := splitKey(&types.KeyInfo{Type: types.KTSecp256k1, PrivateKey: []byte("fedcba9876543210fedcba9876543210")}, 2, 3)
+	require.NoError(t, err)
+	_, err = combineKey([][]byte{shares[0], other[1]})
+	require.EqualError(t, err, "checksum mismatch, the shares are corrupted or belong to different keys")
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/filecoin-project/lotus/lib/lotuslog"
 	"github.com/filecoin-project/specs-actors/actors/builtin/multisig"
 	lcli "github.com/guoxiaopeng875/lotus-adapter/cmd/cli"
+	"github.com/guoxiaopeng875/lotus-adapter/envelope"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/urfave/cli/v2"
 	"os"
@@ -22,6 +23,7 @@ func main() {
 
 	local := []*cli.Command{
 		pushCmd,
+		prepareCmd,
 	}
 
 	app := &cli.App{
@@ -54,6 +56,10 @@ var pushCmd = &cli.Command{
 			Usage: "message data",
 			Value: "",
 		},
+		&cli.StringFlag{
+			Name:  "envelope",
+			Usage: "signed envelope file written by lotus-wallet sign-envelope, - reads stdin",
+		},
 		&cli.BoolFlag{
 			Name:  "wait",
 			Usage: "wait message on chain",
@@ -82,13 +88,23 @@ var pushCmd = &cli.Command{
 		}
 		defer closer()
 
-		msgBytes, err := hex.DecodeString(cctx.String("msg"))
-		if err != nil {
-			return err
-		}
-		sm, err := types.DecodeSignedMessage(msgBytes)
-		if err != nil {
-			return err
+		var sm *types.SignedMessage
+		if cctx.IsSet("envelope") {
+			e, err := envelope.Read(cctx.String("envelope"))
+			if err != nil {
+				return err
+			}
+			if sm, err = e.SignedMessage(); err != nil {
+				return err
+			}
+		} else {
+			msgBytes, err := hex.DecodeString(cctx.String("msg"))
+			if err != nil {
+				return err
+			}
+			if sm, err = types.DecodeSignedMessage(msgBytes); err != nil {
+				return err
+			}
 		}
 		cid, err := api.MpoolPush(ctx, sm)
 		if err != nil {
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/guoxiaopeng875/lotus-adapter/cmd/cli"
+	"github.com/guoxiaopeng875/lotus-adapter/envelope"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+var prepareCmd = &cli.Command{
+	Name:      "prepare",
+	Usage:     "Fill nonce and gas of a message and write an unsigned envelope for the offline wallet",
+	ArgsUsage: "<targetAddress> <amount>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "account to send the message from",
+		},
+		&cli.Uint64Flag{
+			Name:  "method",
+			Usage: "specify method to invoke",
+			Value: 0,
+		},
+		&cli.StringFlag{
+			Name:  "params",
+			Usage: "specify invocation parameters in hex",
+		},
+		&cli.StringFlag{
+			Name:  "max-fee",
+			Usage: "maximum fee (FIL) the message may pay, defaults to the node's config",
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "file the envelope is written to, - writes stdout",
+			Value: "-",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 2 {
+			return xerrors.New("'prepare' expects two arguments, target and amount")
+		}
+		if !cctx.IsSet("from") {
+			return xerrors.New("must specify --from")
+		}
+
+		ctx := lcli.ReqContext(cctx)
+		node, closer, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		from, err := address.NewFromString(cctx.String("from"))
+		if err != nil {
+			return err
+		}
+		to, err := address.NewFromString(cctx.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		value, err := types.ParseFIL(cctx.Args().Get(1))
+		if err != nil {
+			return xerrors.Errorf("parsing amount: %w", err)
+		}
+		params, err := hex.DecodeString(cctx.String("params"))
+		if err != nil {
+			return xerrors.Errorf("parsing params: %w", err)
+		}
+
+		msg := &types.Message{
+			From:   from,
+			To:     to,
+			Value:  types.BigInt(value),
+			Method: abi.MethodNum(cctx.Uint64("method")),
+			Params: params,
+		}
+		var spec *api.MessageSendSpec
+		if cctx.IsSet("max-fee") {
+			maxFee, err := types.ParseFIL(cctx.String("max-fee"))
+			if err != nil {
+				return xerrors.Errorf("parsing max-fee: %w", err)
+			}
+			spec = &api.MessageSendSpec{MaxFee: abi.TokenAmount(maxFee)}
+		}
+		if msg, err = node.GasEstimateMessageGas(ctx, msg, spec, types.EmptyTSK); err != nil {
+			return xerrors.Errorf("estimating gas: %w", err)
+		}
+		// 包含消息池中还未上链的消息
+		if msg.Nonce, err = node.MpoolGetNonce(ctx, from); err != nil {
+			return xerrors.Errorf("getting nonce: %w", err)
+		}
+
+		// 离线钱包根据actor类型解析方法和参数
+		actors := make(map[address.Address]string)
+		targets := []address.Address{msg.To}
+		if inner, ok := envelope.ProposalTarget(msg); ok {
+			targets = append(targets, inner)
+		}
+		for _, addr := range targets {
+			act, err := node.StateGetActor(ctx, addr, types.EmptyTSK)
+			if err != nil {
+				// 还不存在的地址
+				log.Warnf("getting actor %s: %s", addr, err)
+				continue
+			}
+			if kind := envelope.ActorKind(act.Code); kind != "" {
+				actors[addr] = kind
+			}
+		}
+
+		e := envelope.New(msg, actors)
+		fmt.Fprintln(os.Stderr, strings.Join(e.Summary, "\n"))
+		return envelope.Write(cctx.String("output"), e)
+	},
+}
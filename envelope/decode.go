@@ -0,0 +1,190 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/types"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	builtin2 "github.com/filecoin-project/specs-actors/v2/actors/builtin"
+	init2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/init"
+	market2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/market"
+	miner2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/miner"
+	multisig2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/multisig"
+	power2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/power"
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// 可以解析方法名和参数的actor类型
+const (
+	ActorAccount  = "account"
+	ActorInit     = "init"
+	ActorMiner    = "miner"
+	ActorMultisig = "multisig"
+	ActorMarket   = "market"
+	ActorPower    = "power"
+)
+
+// actorMethods 方法名取自 builtin.MethodsXxx 的字段名, 参数类型取自actor导出方法的第二个参数
+type actorMethods struct {
+	names   map[abi.MethodNum]string
+	exports []interface{}
+}
+
+var methodTables = map[string]*actorMethods{
+	ActorAccount:  newActorMethods(builtin2.MethodsAccount, nil),
+	ActorInit:     newActorMethods(builtin2.MethodsInit, init2.Actor{}.Exports()),
+	ActorMiner:    newActorMethods(builtin2.MethodsMiner, miner2.Actor{}.Exports()),
+	ActorMultisig: newActorMethods(builtin2.MethodsMultisig, multisig2.Actor{}.Exports()),
+	ActorMarket:   newActorMethods(builtin2.MethodsMarket, market2.Actor{}.Exports()),
+	ActorPower:    newActorMethods(builtin2.MethodsPower, power2.Actor{}.Exports()),
+}
+
+func newActorMethods(methods interface{}, exports []interface{}) *actorMethods {
+	am := &actorMethods{names: make(map[abi.MethodNum]string), exports: exports}
+	v := reflect.ValueOf(methods)
+	for i := 0; i < v.NumField(); i++ {
+		am.names[abi.MethodNum(v.Field(i).Uint())] = v.Type().Field(i).Name
+	}
+	return am
+}
+
+// params 返回方法参数的新实例, 方法没有参数时返回nil
+func (am *actorMethods) params(m abi.MethodNum) (cbg.CBORUnmarshaler, bool) {
+	if int(m) >= len(am.exports) || am.exports[m] == nil {
+		return nil, false
+	}
+	t := reflect.TypeOf(am.exports[m]).In(1)
+	if t == reflect.TypeOf((*abi.EmptyValue)(nil)) {
+		return nil, true
+	}
+	u, ok := reflect.New(t.Elem()).Interface().(cbg.CBORUnmarshaler)
+	return u, ok
+}
+
+// ActorKind 返回actor代码对应的类型, 不支持的actor返回空
+func ActorKind(code cid.Cid) string {
+	switch code {
+	case builtin0.AccountActorCodeID, builtin2.AccountActorCodeID:
+		return ActorAccount
+	case builtin0.InitActorCodeID, builtin2.InitActorCodeID:
+		return ActorInit
+	case builtin0.StorageMinerActorCodeID, builtin2.StorageMinerActorCodeID:
+		return ActorMiner
+	case builtin0.MultisigActorCodeID, builtin2.MultisigActorCodeID:
+		return ActorMultisig
+	case builtin0.StorageMarketActorCodeID, builtin2.StorageMarketActorCodeID:
+		return ActorMarket
+	case builtin0.StoragePowerActorCodeID, builtin2.StoragePowerActorCodeID:
+		return ActorPower
+	}
+	return ""
+}
+
+// kindOf 地址固定的系统actor不需要提供类型
+func kindOf(addr address.Address, actors map[address.Address]string) string {
+	if k, ok := actors[addr]; ok {
+		return k
+	}
+	switch addr {
+	case builtin2.InitActorAddr:
+		return ActorInit
+	case builtin2.StoragePowerActorAddr:
+		return ActorPower
+	case builtin2.StorageMarketActorAddr:
+		return ActorMarket
+	}
+	return ""
+}
+
+// ProposalTarget 消息是多签提议时返回提议调用的地址
+func ProposalTarget(msg *types.Message) (address.Address, bool) {
+	if msg.Method != builtin2.MethodsMultisig.Propose {
+		return address.Undef, false
+	}
+	var pp multisig2.ProposeParams
+	if err := pp.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+		return address.Undef, false
+	}
+	return pp.To, true
+}
+
+// describeCall 列出调用的方法名和解析后的参数. actors 为已知的地址到actor类型的映射
+func describeCall(to address.Address, method abi.MethodNum, params []byte, actors map[address.Address]string) []string {
+	if method == builtin2.MethodSend {
+		lines := []string{"Method:      Send (0)"}
+		if len(params) > 0 {
+			lines = append(lines, fmt.Sprintf("Params:      %s", hex.EncodeToString(params)))
+		}
+		return lines
+	}
+
+	kind := kindOf(to, actors)
+	am, ok := methodTables[kind]
+	if !ok {
+		return []string{
+			fmt.Sprintf("Method:      %d (unknown actor, not decoded)", method),
+			fmt.Sprintf("Params:      %s", hex.EncodeToString(params)),
+		}
+	}
+	name, ok := am.names[method]
+	if !ok {
+		name = "unknown method"
+	}
+	lines := []string{fmt.Sprintf("Method:      %s (%d) on %s", name, method, kind)}
+	p, ok := am.params(method)
+	if !ok {
+		return append(lines, fmt.Sprintf("Params:      %s (not decoded)", hex.EncodeToString(params)))
+	}
+	if p == nil {
+		if len(params) > 0 {
+			lines = append(lines, fmt.Sprintf("Params:      %s (unexpected params)", hex.EncodeToString(params)))
+		}
+		return lines
+	}
+	if err := p.UnmarshalCBOR(bytes.NewReader(params)); err != nil {
+		return append(lines, fmt.Sprintf("Params:      %s (failed to decode: %s)", hex.EncodeToString(params), err))
+	}
+
+	switch v := p.(type) {
+	case *multisig2.ProposeParams:
+		// 提议的调用也需要展开
+		lines = append(lines, "Proposal:",
+			fmt.Sprintf("  To:          %s", v.To),
+			fmt.Sprintf("  Value:       %s", types.FIL(v.Value)))
+		for _, l := range describeCall(v.To, v.Method, v.Params, actors) {
+			lines = append(lines, "  "+l)
+		}
+		return lines
+	case *init2.ExecParams:
+		lines = append(lines, fmt.Sprintf("Code:        %s", builtin2.ActorNameByCode(v.CodeCID)))
+		if cm, ok := methodTables[ActorKind(v.CodeCID)]; ok {
+			if cp, ok := cm.params(builtin2.MethodConstructor); ok && cp != nil {
+				if err := cp.UnmarshalCBOR(bytes.NewReader(v.ConstructorParams)); err == nil {
+					return append(lines, jsonLines("Constructor:", cp)...)
+				}
+			}
+		}
+		return append(lines, fmt.Sprintf("Constructor: %s", hex.EncodeToString(v.ConstructorParams)))
+	}
+	return append(lines, jsonLines("Params:", p)...)
+}
+
+func jsonLines(title string, v interface{}) []string {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return []string{fmt.Sprintf("%s %v", title, v)}
+	}
+	lines := []string{title}
+	for _, l := range strings.Split(string(b), "\n") {
+		lines = append(lines, "  "+l)
+	}
+	return lines
+}
@@ -0,0 +1,67 @@
+package envelope
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/types"
+	builtin2 "github.com/filecoin-project/specs-actors/v2/actors/builtin"
+	miner2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/miner"
+	multisig2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/multisig"
+	"github.com/stretchr/testify/require"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+func serialize(t *testing.T, v cbg.CBORMarshaler) []byte {
+	buf := new(bytes.Buffer)
+	require.NoError(t, v.MarshalCBOR(buf))
+	return buf.Bytes()
+}
+
+func TestDescribeCall(t *testing.T) {
+	msig, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	maddr, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	worker, err := address.NewIDAddress(1002)
+	require.NoError(t, err)
+	actors := map[address.Address]string{msig: ActorMultisig, maddr: ActorMiner}
+
+	// 多签提议里的 ChangeWorkerAddress 也要解析出来
+	inner := serialize(t, &miner2.ChangeWorkerAddressParams{NewWorker: worker})
+	msg := &types.Message{
+		To:     msig,
+		Method: builtin2.MethodsMultisig.Propose,
+		Params: serialize(t, &multisig2.ProposeParams{
+			To:     maddr,
+			Value:  abi.NewTokenAmount(0),
+			Method: builtin2.MethodsMiner.ChangeWorkerAddress,
+			Params: inner,
+		}),
+	}
+	to, ok := ProposalTarget(msg)
+	require.True(t, ok)
+	require.Equal(t, maddr, to)
+
+	lines := describeCall(msg.To, msg.Method, msg.Params, actors)
+	require.Equal(t, "Method:      Propose (2) on multisig", lines[0])
+	require.Contains(t, lines, "  Method:      ChangeWorkerAddress (3) on miner")
+	require.Contains(t, lines, `      "NewWorker": "f01002",`)
+
+	// 不知道类型时只显示原始参数
+	lines = describeCall(maddr, builtin2.MethodsMiner.WithdrawBalance,
+		serialize(t, &miner2.WithdrawBalanceParams{AmountRequested: types.FromFil(1)}), nil)
+	require.Equal(t, "Method:      16 (unknown actor, not decoded)", lines[0])
+
+	lines = describeCall(maddr, builtin2.MethodsMiner.WithdrawBalance,
+		serialize(t, &miner2.WithdrawBalanceParams{AmountRequested: types.FromFil(1)}), actors)
+	require.Equal(t, []string{
+		"Method:      WithdrawBalance (16) on miner",
+		"Params:",
+		"  {",
+		`    "AmountRequested": "1000000000000000000"`,
+		"  }",
+	}, lines)
+}
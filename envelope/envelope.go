@@ -0,0 +1,141 @@
+package envelope
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// Version 信封格式的版本
+const Version = 1
+
+// Envelope 联网机器准备好nonce和gas的待签名消息, 离线钱包签名后填上 Signature, 再由 mpool-push 推送
+type Envelope struct {
+	Version int `json:"version"`
+	// 消息的CID, 签名的内容
+	Cid        cid.Cid        `json:"cid"`
+	Message    *types.Message `json:"message"`
+	PreparedAt time.Time      `json:"prepared_at"`
+	// 准备时从链上查到的地址的actor类型, 用于解析方法和参数
+	Actors map[string]string `json:"actors,omitempty"`
+	// 准备时生成的消息说明, 仅供阅读. 离线钱包应根据 Message 重新生成后展示
+	Summary   []string          `json:"summary"`
+	Signature *crypto.Signature `json:"signature,omitempty"`
+}
+
+func New(msg *types.Message, actors map[address.Address]string) *Envelope {
+	e := &Envelope{
+		Version:    Version,
+		Cid:        msg.Cid(),
+		Message:    msg,
+		PreparedAt: time.Now(),
+		Actors:     make(map[string]string, len(actors)),
+		Summary:    Describe(msg, actors),
+	}
+	for addr, kind := range actors {
+		e.Actors[addr.String()] = kind
+	}
+	return e
+}
+
+// ActorKinds 返回信封中记录的actor类型
+func (e *Envelope) ActorKinds() (map[address.Address]string, error) {
+	actors := make(map[address.Address]string, len(e.Actors))
+	for a, kind := range e.Actors {
+		addr, err := address.NewFromString(a)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing actor address %s: %w", a, err)
+		}
+		actors[addr] = kind
+	}
+	return actors, nil
+}
+
+// Verify 检查格式版本以及 Cid 与消息是否一致
+func (e *Envelope) Verify() error {
+	if e.Version != Version {
+		return xerrors.Errorf("unsupported envelope version %d", e.Version)
+	}
+	if e.Message == nil {
+		return xerrors.New("envelope has no message")
+	}
+	if c := e.Message.Cid(); c != e.Cid {
+		return xerrors.Errorf("message cid %s does not match envelope cid %s", c, e.Cid)
+	}
+	return nil
+}
+
+// SignedMessage 返回签名后的消息
+func (e *Envelope) SignedMessage() (*types.SignedMessage, error) {
+	if err := e.Verify(); err != nil {
+		return nil, err
+	}
+	if e.Signature == nil {
+		return nil, xerrors.New("envelope is not signed")
+	}
+	return &types.SignedMessage{Message: *e.Message, Signature: *e.Signature}, nil
+}
+
+// Describe 逐行列出消息的各字段, 金额以FIL为单位. 已知actor类型的调用会解析出方法名和参数,
+// actors 为地址到actor类型(ActorMiner等)的映射, 系统actor不需要提供
+func Describe(msg *types.Message, actors map[address.Address]string) []string {
+	maxFee := big.Mul(msg.GasFeeCap, big.NewInt(msg.GasLimit))
+	lines := []string{
+		fmt.Sprintf("From:        %s", msg.From),
+		fmt.Sprintf("To:          %s", msg.To),
+		fmt.Sprintf("Value:       %s", types.FIL(msg.Value)),
+	}
+	lines = append(lines, describeCall(msg.To, msg.Method, msg.Params, actors)...)
+	return append(lines,
+		fmt.Sprintf("Nonce:       %d", msg.Nonce),
+		fmt.Sprintf("Gas limit:   %d", msg.GasLimit),
+		fmt.Sprintf("Gas fee cap: %s", msg.GasFeeCap),
+		fmt.Sprintf("Gas premium: %s", msg.GasPremium),
+		fmt.Sprintf("Max fee:     %s", types.FIL(maxFee)),
+	)
+}
+
+// Read 从文件读取信封, path 为 - 时读取标准输入
+func Read(path string) (*Envelope, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e Envelope
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, xerrors.Errorf("decoding envelope: %w", err)
+	}
+	if err := e.Verify(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Write 把信封写入文件, path 为 - 时写到标准输出
+func Write(path string, e *Envelope) error {
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,49 @@
+package envelope
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	from, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	to, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	msg := &types.Message{
+		From:       from,
+		To:         to,
+		Value:      types.FromFil(2),
+		Method:     abi.MethodNum(0),
+		Nonce:      7,
+		GasLimit:   1000,
+		GasFeeCap:  abi.NewTokenAmount(100),
+		GasPremium: abi.NewTokenAmount(10),
+	}
+
+	path := filepath.Join(t.TempDir(), "msg.json")
+	require.NoError(t, Write(path, New(msg, nil)))
+	e, err := Read(path)
+	require.NoError(t, err)
+	require.Equal(t, msg.Cid(), e.Message.Cid())
+	require.Contains(t, e.Summary, "Value:       2 FIL")
+
+	_, err = e.SignedMessage()
+	require.EqualError(t, err, "envelope is not signed")
+	e.Signature = &crypto.Signature{Type: crypto.SigTypeSecp256k1, Data: []byte{1}}
+	sm, err := e.SignedMessage()
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), sm.Message.Nonce)
+
+	// 修改消息后 cid 不再一致
+	e.Message.Value = types.FromFil(200)
+	require.NoError(t, Write(path, e))
+	_, err = Read(path)
+	require.Error(t, err)
+}
@@ -3,6 +3,9 @@ module github.com/guoxiaopeng875/lotus-adapter
 go 1.15
 
 require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/btcsuite/btcd v0.20.1-beta
+	github.com/docker/go-units v0.4.0
 	github.com/filecoin-project/go-address v0.0.5-0.20201103152444-f2023ef3f5bb
 	github.com/filecoin-project/go-bitfield v0.2.3-0.20201110211213-fe2c1862e816
 	github.com/filecoin-project/go-jsonrpc v0.1.2-0.20201008195726-68c6a2704e49
@@ -18,6 +21,8 @@ require (
 	github.com/gorilla/mux v1.7.4
 	github.com/hako/durafmt v0.0.0-20200710122514-c0fb7b4da026
 	github.com/ipfs/go-cid v0.0.7
+	github.com/ipfs/go-datastore v0.4.5
+	github.com/ipfs/go-ds-leveldb v0.4.2
 	github.com/ipfs/go-ipld-cbor v0.0.5
 	github.com/ipfs/go-log/v2 v2.1.2-0.20200626104915-0016c0b4b3e4
 	github.com/json-iterator/go v1.1.10 // indirect
@@ -26,9 +31,11 @@ require (
 	github.com/multiformats/go-multiaddr v0.3.1
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/stretchr/testify v1.6.1
+	github.com/tyler-smith/go-bip39 v1.1.0
 	github.com/ugorji/go v1.1.13 // indirect
 	github.com/urfave/cli/v2 v2.2.0
 	github.com/whyrusleeping/cbor-gen v0.0.0-20200826160007-0b9f6c5fb163
+	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
 	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
 	gopkg.in/resty.v1 v1.12.0
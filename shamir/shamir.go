@@ -0,0 +1,115 @@
+// Package shamir 在GF(256)上实现Shamir秘密分享, 用于把私钥拆成多份分开保存
+package shamir
+
+import (
+	"crypto/rand"
+
+	"golang.org/x/xerrors"
+)
+
+// GF(256) 的乘法表, 使用AES的不可约多项式 x^8+x^4+x^3+x+1, 生成元为3
+var (
+	expTable [255]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+		// x *= 3
+		x ^= xtime(x)
+	}
+}
+
+func xtime(b byte) byte {
+	if b&0x80 != 0 {
+		return b<<1 ^ 0x1b
+	}
+	return b << 1
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+// Split 把secret拆成n份, 任意k份可以恢复. 每份的第一个字节是x坐标, 之后与secret等长
+func Split(secret []byte, k, n int) ([][]byte, error) {
+	if k < 2 || k > n || n > 255 {
+		return nil, xerrors.Errorf("invalid threshold %d/%d, need 2 <= k <= n <= 255", k, n)
+	}
+	if len(secret) == 0 {
+		return nil, xerrors.New("empty secret")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+	// 每个字节使用一个常数项为该字节的k-1次随机多项式
+	coeffs := make([]byte, k)
+	for j, s := range secret {
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		coeffs[0] = s
+		for _, share := range shares {
+			x := share[0]
+			// Horner
+			var y byte
+			for c := k - 1; c >= 0; c-- {
+				y = mul(y, x) ^ coeffs[c]
+			}
+			share[j+1] = y
+		}
+	}
+	return shares, nil
+}
+
+// Combine 用拉格朗日插值恢复secret, 份数少于拆分时的k时得到错误的结果
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, xerrors.New("at least two shares are required")
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, xerrors.New("share is too short")
+	}
+	seen := make(map[byte]bool, len(shares))
+	for _, s := range shares {
+		if len(s) != size {
+			return nil, xerrors.New("shares have different lengths")
+		}
+		if s[0] == 0 || seen[s[0]] {
+			return nil, xerrors.Errorf("invalid or duplicate share %d", s[0])
+		}
+		seen[s[0]] = true
+	}
+
+	secret := make([]byte, size-1)
+	for i, si := range shares {
+		// 基函数在0处的值 prod x_j / (x_j - x_i), GF(256) 中减法即异或
+		basis := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				basis = mul(basis, div(sj[0], sj[0]^si[0]))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= mul(si[b+1], basis)
+		}
+	}
+	return secret, nil
+}
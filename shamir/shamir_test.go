@@ -0,0 +1,45 @@
+package shamir
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("lotus wallet key")
+	shares, err := Split(secret, 3, 5)
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+
+	for _, idx := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var sel [][]byte
+		for _, i := range idx {
+			sel = append(sel, shares[i])
+		}
+		got, err := Combine(sel)
+		require.NoError(t, err)
+		require.Equal(t, secret, got, idx)
+	}
+
+	// 份数不够时得不到原文
+	got, err := Combine(shares[:2])
+	require.NoError(t, err)
+	require.NotEqual(t, secret, got)
+
+	_, err = Combine([][]byte{shares[0], shares[0]})
+	require.Error(t, err)
+	_, err = Split(secret, 1, 3)
+	require.Error(t, err)
+}
+
+func TestField(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		require.Equal(t, byte(1), div(byte(a), byte(a)))
+		for _, b := range []byte{1, 2, 3, 0x53, 0xca, 0xff} {
+			require.Equal(t, byte(a), div(mul(byte(a), b), b))
+		}
+	}
+	// AES中的例子 0x53 * 0xca = 1
+	require.Equal(t, byte(1), mul(0x53, 0xca))
+}
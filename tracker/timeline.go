@@ -0,0 +1,187 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+)
+
+// 扇区时间线的key:
+//
+//	/timeline/<sector>/tasks/<start unix nano>-<task>-<workerID>
+//	/timeline/<sector>/states/<unix nano>
+var timelinePrefix = datastore.NewKey("/timeline")
+
+// 进入这些状态后不再轮询扇区状态
+var finalStates = map[string]struct{}{
+	"Proving":             {},
+	"Removed":             {},
+	"FailedUnrecoverable": {},
+}
+
+// ObserveState 记录轮询到的扇区状态, 状态变化时记入时间线
+func (t *Tracker) ObserveState(sector uint64, state string, now time.Time) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	last, ok := t.states[sector]
+	if !ok {
+		l, err := t.lastState(sector)
+		if err != nil {
+			return err
+		}
+		last = l
+	}
+	t.states[sector] = state
+	if last == state {
+		return nil
+	}
+
+	b, err := json.Marshal(&apitypes.SectorStateChange{State: state, At: now})
+	if err != nil {
+		return err
+	}
+	if err := t.ds.Put(sectorKey(sector).ChildString("states").ChildString(nanoString(now)), b); err != nil {
+		return xerrors.Errorf("saving sector state: %w", err)
+	}
+	return nil
+}
+
+// ForgetSector 不再轮询已经不存在的扇区, 时间线保留
+func (t *Tracker) ForgetSector(sector uint64) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	delete(t.states, sector)
+}
+
+// ActiveSectors 返回需要轮询状态的扇区: 正在运行任务的, 以及最近状态还不是终态的
+func (t *Tracker) ActiveSectors() []uint64 {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	set := map[uint64]struct{}{}
+	for k := range t.running {
+		set[k.sector] = struct{}{}
+	}
+	for sector, state := range t.states {
+		if _, final := finalStates[state]; final {
+			delete(t.states, sector)
+			continue
+		}
+		set[sector] = struct{}{}
+	}
+
+	out := make([]uint64, 0, len(set))
+	for sector := range set {
+		out = append(out, sector)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Timeline 返回扇区记录到的全部任务和状态变化, 按时间排序
+func (t *Tracker) Timeline(sector uint64) (*apitypes.SectorTimeline, error) {
+	tl := &apitypes.SectorTimeline{SectorNum: sector}
+
+	if err := t.forEach(sectorKey(sector).ChildString("tasks"), func(b []byte) error {
+		var span apitypes.SectorTaskSpan
+		if err := json.Unmarshal(b, &span); err != nil {
+			return err
+		}
+		tl.Tasks = append(tl.Tasks, &span)
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("loading sector tasks: %w", err)
+	}
+
+	if err := t.forEach(sectorKey(sector).ChildString("states"), func(b []byte) error {
+		var sc apitypes.SectorStateChange
+		if err := json.Unmarshal(b, &sc); err != nil {
+			return err
+		}
+		tl.States = append(tl.States, &sc)
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("loading sector states: %w", err)
+	}
+
+	sort.SliceStable(tl.Tasks, func(i, j int) bool {
+		return tl.Tasks[i].Start.Before(tl.Tasks[j].Start)
+	})
+	return tl, nil
+}
+
+func (t *Tracker) putSpan(sector uint64, span *apitypes.SectorTaskSpan) error {
+	b, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s-%s", nanoString(span.Start), span.Task, url.PathEscape(span.WorkerID))
+	if err := t.ds.Put(sectorKey(sector).ChildString("tasks").ChildString(name), b); err != nil {
+		return xerrors.Errorf("saving sector task: %w", err)
+	}
+	return nil
+}
+
+func (t *Tracker) lastState(sector uint64) (string, error) {
+	res, err := t.ds.Query(query.Query{
+		Prefix: sectorKey(sector).ChildString("states").String(),
+		Orders: []query.Order{query.OrderByKeyDescending{}},
+		Limit:  1,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return "", r.Error
+		}
+		var sc apitypes.SectorStateChange
+		if err := json.Unmarshal(r.Value, &sc); err != nil {
+			return "", err
+		}
+		return sc.State, nil
+	}
+	return "", nil
+}
+
+func (t *Tracker) forEach(prefix datastore.Key, cb func([]byte) error) error {
+	res, err := t.ds.Query(query.Query{
+		Prefix: prefix.String(),
+		Orders: []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		if err := cb(r.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sectorKey(sector uint64) datastore.Key {
+	return timelinePrefix.ChildString(strconv.FormatUint(sector, 10))
+}
+
+// 定长数字保证按key排序即按时间排序
+func nanoString(t time.Time) string {
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
@@ -0,0 +1,243 @@
+package tracker
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("tracker")
+
+// 耗时样本的key前缀: /samples/<task>/<hostname>
+var samplesPrefix = datastore.NewKey("/samples")
+
+type Options struct {
+	// 每个 worker+任务类型 保留的耗时样本数
+	MaxSamples int
+	// worker自身样本少于该值时使用所有worker的样本计算基准耗时
+	MinSamples int
+	// 运行时间超过基准耗时的倍数时标记为卡住
+	StuckFactor float64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxSamples:  20,
+		MinSamples:  3,
+		StuckFactor: 2,
+	}
+}
+
+type jobKey struct {
+	worker string
+	task   string
+	sector uint64
+}
+
+type runningJob struct {
+	hostname string
+	start    time.Time
+	span     *apitypes.SectorTaskSpan
+	// worker曾经不在快照中, 期间任务的状态未知, 结束时不计入耗时样本
+	interrupted bool
+}
+
+type sampleKey struct {
+	task     string
+	hostname string
+}
+
+// Tracker 根据连续的worker任务快照学习每台worker各类任务的耗时,
+// 并标记运行时间超出基准耗时的任务; 同时记录每个扇区的任务起止和状态变化时间线
+type Tracker struct {
+	lk      sync.Mutex
+	ds      datastore.Batching
+	opts    Options
+	running map[jobKey]runningJob
+	// 最近的耗时样本(秒), 新样本在后
+	samples map[sampleKey][]int64
+	// 扇区最近观察到的状态
+	states map[uint64]string
+}
+
+func New(ds datastore.Batching, opts Options) (*Tracker, error) {
+	t := &Tracker{
+		ds:      ds,
+		opts:    opts,
+		running: make(map[jobKey]runningJob),
+		samples: make(map[sampleKey][]int64),
+		states:  make(map[uint64]string),
+	}
+
+	res, err := ds.Query(query.Query{Prefix: samplesPrefix.String()})
+	if err != nil {
+		return nil, xerrors.Errorf("querying task samples: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("reading task samples: %w", r.Error)
+		}
+		k := datastore.NewKey(r.Key)
+		ns := k.Namespaces()
+		if len(ns) != 3 {
+			continue
+		}
+		var s []int64
+		if err := json.Unmarshal(r.Value, &s); err != nil {
+			return nil, xerrors.Errorf("decoding task samples %s: %w", r.Key, err)
+		}
+		t.samples[sampleKey{task: ns[1], hostname: ns[2]}] = s
+	}
+	return t, nil
+}
+
+// Observe 记录一次完整的worker任务快照. 新出现的任务记入扇区时间线, 上次在运行而本次消失的任务视为已完成,
+// 计入耗时样本; worker不在快照中时保留其任务, 之后结束时不计入样本.
+// 本次仍在运行的任务会填上运行时间, 基准耗时和是否卡住
+func (t *Tracker) Observe(states []*apitypes.WorkerTaskState, now time.Time) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	seen := make(map[jobKey]struct{})
+	workers := make(map[string]struct{}, len(states))
+	for _, w := range states {
+		workers[w.ID] = struct{}{}
+		for _, ss := range w.SectorStates {
+			if ss.RunWait != 0 {
+				continue
+			}
+			k := jobKey{worker: w.ID, task: ss.Task, sector: ss.SectorNum}
+			seen[k] = struct{}{}
+			if _, ok := t.running[k]; !ok {
+				span := &apitypes.SectorTaskSpan{
+					Task:     ss.Task,
+					WorkerID: w.ID,
+					Hostname: w.Hostname,
+					Start:    ss.Start,
+				}
+				if err := t.putSpan(ss.SectorNum, span); err != nil {
+					return err
+				}
+				t.running[k] = runningJob{hostname: w.Hostname, start: ss.Start, span: span}
+			}
+		}
+	}
+
+	for k, rj := range t.running {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		if _, ok := workers[k.worker]; !ok {
+			rj.interrupted = true
+			t.running[k] = rj
+			continue
+		}
+		delete(t.running, k)
+		end := now
+		rj.span.End = &end
+		rj.span.Duration = int64(now.Sub(rj.start) / time.Second)
+		if err := t.putSpan(k.sector, rj.span); err != nil {
+			return err
+		}
+		if rj.interrupted {
+			continue
+		}
+		if err := t.addSample(sampleKey{task: k.task, hostname: rj.hostname}, now.Sub(rj.start)); err != nil {
+			return err
+		}
+	}
+
+	t.annotate(states, now)
+	return nil
+}
+
+// Annotate 只给正在运行的任务填上基准耗时和是否卡住, 不更新样本
+func (t *Tracker) Annotate(states []*apitypes.WorkerTaskState, now time.Time) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	t.annotate(states, now)
+}
+
+// Baseline 返回某台worker某类任务的基准耗时(耗时样本的中位数)
+func (t *Tracker) Baseline(hostname, task string) (time.Duration, bool) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	return t.baseline(hostname, task)
+}
+
+func (t *Tracker) annotate(states []*apitypes.WorkerTaskState, now time.Time) {
+	for _, w := range states {
+		for _, ss := range w.SectorStates {
+			if ss.RunWait != 0 {
+				continue
+			}
+			elapsed := now.Sub(ss.Start)
+			ss.TaskTime = int64(elapsed / time.Second)
+			base, ok := t.baseline(w.Hostname, ss.Task)
+			if !ok {
+				continue
+			}
+			ss.Baseline = int64(base / time.Second)
+			ss.Stuck = float64(elapsed) > float64(base)*t.opts.StuckFactor
+		}
+	}
+}
+
+func (t *Tracker) baseline(hostname, task string) (time.Duration, bool) {
+	own := t.samples[sampleKey{task: task, hostname: hostname}]
+	if len(own) >= t.opts.MinSamples {
+		return median(own), true
+	}
+
+	var all []int64
+	for k, s := range t.samples {
+		if k.task == task {
+			all = append(all, s...)
+		}
+	}
+	if len(all) < t.opts.MinSamples || len(all) == 0 {
+		return 0, false
+	}
+	return median(all), true
+}
+
+func (t *Tracker) addSample(k sampleKey, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	s := append(t.samples[k], int64(d/time.Second))
+	if len(s) > t.opts.MaxSamples {
+		s = s[len(s)-t.opts.MaxSamples:]
+	}
+	t.samples[k] = s
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := t.ds.Put(samplesPrefix.ChildString(k.task).ChildString(k.hostname), b); err != nil {
+		return xerrors.Errorf("saving task samples: %w", err)
+	}
+	log.Debugw("task finished", "task", k.task, "hostname", k.hostname, "took", d)
+	return nil
+}
+
+func median(s []int64) time.Duration {
+	sorted := append([]int64(nil), s...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return time.Duration((sorted[mid-1]+sorted[mid])/2) * time.Second
+	}
+	return time.Duration(sorted[mid]) * time.Second
+}
@@ -0,0 +1,132 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/guoxiaopeng875/lotus-adapter/api/apitypes"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackerBaseline(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	opts := DefaultOptions()
+	tk, err := New(ds, opts)
+	require.NoError(t, err)
+
+	now := time.Now()
+	// 在 w1 上依次完成三个耗时 1h, 2h, 3h 的 PC1
+	for i, took := range []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour} {
+		start := now
+		require.NoError(t, tk.Observe([]*apitypes.WorkerTaskState{
+			{ID: "w1", Hostname: "h1", SectorStates: []*apitypes.SectorState{
+				{Task: "PC1", SectorNum: uint64(i), Start: start},
+			}},
+		}, now))
+		now = now.Add(took)
+		require.NoError(t, tk.Observe([]*apitypes.WorkerTaskState{{ID: "w1", Hostname: "h1"}}, now))
+	}
+
+	base, ok := tk.Baseline("h1", "PC1")
+	require.True(t, ok)
+	require.Equal(t, 2*time.Hour, base)
+
+	// 其他worker样本不足时使用所有worker的样本
+	base, ok = tk.Baseline("h2", "PC1")
+	require.True(t, ok)
+	require.Equal(t, 2*time.Hour, base)
+
+	_, ok = tk.Baseline("h1", "PC2")
+	require.False(t, ok)
+
+	states := []*apitypes.WorkerTaskState{
+		{ID: "w1", Hostname: "h1", SectorStates: []*apitypes.SectorState{
+			{Task: "PC1", SectorNum: 10, Start: now.Add(-5 * time.Hour)},
+			{Task: "PC1", SectorNum: 11, Start: now.Add(-time.Hour)},
+			{Task: "PC1", SectorNum: 12, Start: now.Add(-5 * time.Hour), RunWait: 1},
+		}},
+	}
+	tk.Annotate(states, now)
+	ss := states[0].SectorStates
+	require.True(t, ss[0].Stuck)
+	require.Equal(t, int64(5*3600), ss[0].TaskTime)
+	require.Equal(t, int64(2*3600), ss[0].Baseline)
+	require.False(t, ss[1].Stuck)
+	require.False(t, ss[2].Stuck)
+	require.Zero(t, ss[2].Baseline)
+
+	// worker掉线期间消失的任务不计入样本, 之后再消失也不计入
+	for i := 0; i < opts.MinSamples; i++ {
+		require.NoError(t, tk.Observe([]*apitypes.WorkerTaskState{
+			{ID: "w2", Hostname: "h2", SectorStates: []*apitypes.SectorState{
+				{Task: "PC2", SectorNum: uint64(20 + i), Start: now},
+			}},
+		}, now))
+		now = now.Add(time.Hour)
+		require.NoError(t, tk.Observe(nil, now))
+		now = now.Add(time.Hour)
+		require.NoError(t, tk.Observe([]*apitypes.WorkerTaskState{{ID: "w2", Hostname: "h2"}}, now))
+	}
+	_, ok = tk.Baseline("h2", "PC2")
+	require.False(t, ok)
+
+	// 样本会持久化
+	tk2, err := New(ds, opts)
+	require.NoError(t, err)
+	base, ok = tk2.Baseline("h1", "PC1")
+	require.True(t, ok)
+	require.Equal(t, 2*time.Hour, base)
+}
+
+func TestTrackerTimeline(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	tk, err := New(ds, DefaultOptions())
+	require.NoError(t, err)
+
+	start := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, tk.Observe([]*apitypes.WorkerTaskState{
+		{ID: "w1", Hostname: "h1", SectorStates: []*apitypes.SectorState{
+			{Task: "PC1", SectorNum: 7, Start: start},
+		}},
+	}, start))
+	require.Equal(t, []uint64{7}, tk.ActiveSectors())
+	require.NoError(t, tk.ObserveState(7, "PreCommit1", start))
+	require.NoError(t, tk.ObserveState(7, "PreCommit1", start.Add(time.Minute)))
+
+	end := start.Add(3 * time.Hour)
+	require.NoError(t, tk.Observe([]*apitypes.WorkerTaskState{
+		{ID: "w1", Hostname: "h1", SectorStates: []*apitypes.SectorState{
+			{Task: "PC2", SectorNum: 7, Start: end},
+		}},
+	}, end))
+	require.NoError(t, tk.ObserveState(7, "PreCommit2", end))
+
+	tl, err := tk.Timeline(7)
+	require.NoError(t, err)
+	require.Len(t, tl.Tasks, 2)
+	require.Equal(t, "PC1", tl.Tasks[0].Task)
+	require.Equal(t, int64(3*3600), tl.Tasks[0].Duration)
+	require.NotNil(t, tl.Tasks[0].End)
+	require.Equal(t, "PC2", tl.Tasks[1].Task)
+	require.Nil(t, tl.Tasks[1].End)
+	require.Len(t, tl.States, 2)
+	require.Equal(t, "PreCommit2", tl.States[1].State)
+
+	// 重启后从datastore读取最近状态, 相同状态不重复记录; 进入终态后不再轮询
+	tk2, err := New(ds, DefaultOptions())
+	require.NoError(t, err)
+	require.NoError(t, tk2.ObserveState(7, "PreCommit2", end.Add(time.Minute)))
+	require.NoError(t, tk2.ObserveState(7, "Proving", end.Add(time.Hour)))
+	require.Empty(t, tk2.ActiveSectors())
+	tl, err = tk2.Timeline(7)
+	require.NoError(t, err)
+	require.Len(t, tl.States, 3)
+
+	// 不存在的扇区不再轮询
+	require.NoError(t, tk2.ObserveState(8, "Packing", end))
+	require.Equal(t, []uint64{8}, tk2.ActiveSectors())
+	tk2.ForgetSector(8)
+	require.Empty(t, tk2.ActiveSectors())
+}